@@ -1,6 +1,7 @@
 package client
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/RoyceAzure/rj/infra/mq/constant"
@@ -14,6 +15,33 @@ type IConsumer interface {
 	ReStart(queueName, tag string, handler func([]byte) error) error
 }
 
+/*
+handler回傳的錯誤實作此介面且Requeue()為true時，訊息以nack重新放回佇列
+其他錯誤仍會ack，避免無法處理的訊息重複投遞
+*/
+type RequeueError interface {
+	error
+	Requeue() bool
+}
+
+type requeueError struct {
+	err error
+}
+
+func (e *requeueError) Error() string { return e.err.Error() }
+func (e *requeueError) Unwrap() error { return e.err }
+func (e *requeueError) Requeue() bool { return true }
+
+// 包裝err，讓consumer將訊息重新放回佇列
+func Requeue(err error) error {
+	return &requeueError{err: err}
+}
+
+func shouldRequeue(err error) bool {
+	var r RequeueError
+	return errors.As(err, &r) && r.Requeue()
+}
+
 type ConsumerV2 struct {
 	*BaseClient
 }
@@ -124,6 +152,11 @@ func (c *ConsumerV2) consume(msgs <-chan amqp.Delivery, handler func([]byte) err
 			// 處理訊息
 			fmt.Printf("Consumer %s_%s, 接收到消息，提交給handler處理\n", c.name, c.id)
 			err := handler(msg.Body)
+			if shouldRequeue(err) {
+				fmt.Printf("Consumer %s_%s, 消息未處理, 重新放回佇列\n", c.name, c.id)
+				msg.Nack(false, true)
+				continue
+			}
 			if err != nil {
 				fmt.Printf("Consumer %s_%s, 處理消息失敗, 拒絕訊息\n", c.name, c.id)
 			}
@@ -0,0 +1,18 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShouldRequeue(t *testing.T) {
+	base := errors.New("shutting down")
+	require.False(t, shouldRequeue(nil))
+	require.False(t, shouldRequeue(base))
+	require.True(t, shouldRequeue(Requeue(base)))
+	require.True(t, shouldRequeue(fmt.Errorf("wrap: %w", Requeue(base))))
+	require.ErrorIs(t, Requeue(base), base)
+}
@@ -57,7 +57,7 @@ func (p *Producer) Publish(exchange, routingKey string, message []byte) error {
 	// 檢查 channel 是否已關閉
 	select {
 	case <-p.done:
-		return fmt.Errorf("producer is closed")
+		return ErrProducerClosed
 	default:
 	}
 
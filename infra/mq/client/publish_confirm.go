@@ -0,0 +1,190 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	ErrProducerClosed = errors.New("producer is closed")
+	ErrProducerFull   = errors.New("producer is full")
+	ErrPublishNacked  = errors.New("message nacked by broker")
+	ErrConfirmTimeout = errors.New("confirmation timeout")
+	ErrChannelClosed  = errors.New("channel closed before confirmation")
+)
+
+/*
+單筆訊息的發送結果
+broker確認(ack)後Err為nil，nack、逾時或channel關閉時為對應錯誤
+*/
+type PublishFuture struct {
+	done      chan struct{}
+	err       error
+	callbacks []func(error)
+	mu        sync.Mutex
+}
+
+func newPublishFuture() *PublishFuture {
+	return &PublishFuture{done: make(chan struct{})}
+}
+
+// 只有第一次呼叫有效
+func (f *PublishFuture) resolve(err error) {
+	f.mu.Lock()
+	select {
+	case <-f.done:
+		f.mu.Unlock()
+		return
+	default:
+	}
+	f.err = err
+	close(f.done)
+	callbacks := f.callbacks
+	f.callbacks = nil
+	f.mu.Unlock()
+
+	for _, cb := range callbacks {
+		cb(err)
+	}
+}
+
+// 發送結果確定時關閉
+func (f *PublishFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// 發送結果，Done關閉前回傳nil
+func (f *PublishFuture) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+// 等待發送結果，ctx結束時回傳ctx.Err()
+func (f *PublishFuture) Wait(ctx context.Context) error {
+	select {
+	case <-f.done:
+		return f.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/*
+結果確定時呼叫cb，已確定時立即呼叫
+cb在確認處理的goroutine中執行，不應阻塞
+*/
+func (f *PublishFuture) OnComplete(cb func(error)) {
+	f.mu.Lock()
+	select {
+	case <-f.done:
+		err := f.err
+		f.mu.Unlock()
+		cb(err)
+		return
+	default:
+	}
+	f.callbacks = append(f.callbacks, cb)
+	f.mu.Unlock()
+}
+
+type pendingPublish struct {
+	future   *PublishFuture
+	deadline time.Time
+}
+
+/*
+追蹤單一channel上等待確認的訊息，以delivery tag對應amqp.Confirmation
+channel重建後delivery tag從1開始，需建立新的tracker
+*/
+type confirmTracker struct {
+	pending map[uint64]*pendingPublish
+	slots   chan struct{} //限制同時等待確認的數量
+	timeout time.Duration
+	mu      sync.Mutex
+}
+
+func newConfirmTracker(maxInFlight int, timeout time.Duration) *confirmTracker {
+	return &confirmTracker{
+		pending: make(map[uint64]*pendingPublish),
+		slots:   make(chan struct{}, maxInFlight),
+		timeout: timeout,
+	}
+}
+
+/*
+發送並登記等待確認，publish需回傳這次發送的delivery tag
+持有mu發送，避免確認早於登記
+呼叫端需先取得slot，發送失敗時釋放
+*/
+func (t *confirmTracker) publish(future *PublishFuture, publish func() (uint64, error)) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tag, err := publish()
+	if err != nil {
+		<-t.slots
+		return err
+	}
+	t.pending[tag] = &pendingPublish{future: future, deadline: time.Now().Add(t.timeout)}
+	return nil
+}
+
+// 依確認結果完成對應的訊息，已逾時的tag忽略
+func (t *confirmTracker) confirm(c amqp.Confirmation) {
+	t.mu.Lock()
+	p, ok := t.pending[c.DeliveryTag]
+	if ok {
+		delete(t.pending, c.DeliveryTag)
+		<-t.slots
+	}
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+	if c.Ack {
+		p.future.resolve(nil)
+	} else {
+		p.future.resolve(ErrPublishNacked)
+	}
+}
+
+// 將超過deadline的訊息以ErrConfirmTimeout完成
+func (t *confirmTracker) expire(now time.Time) {
+	var expired []*pendingPublish
+	t.mu.Lock()
+	for tag, p := range t.pending {
+		if now.After(p.deadline) {
+			expired = append(expired, p)
+			delete(t.pending, tag)
+			<-t.slots
+		}
+	}
+	t.mu.Unlock()
+	for _, p := range expired {
+		p.future.resolve(ErrConfirmTimeout)
+	}
+}
+
+// 將所有等待中的訊息以err完成
+func (t *confirmTracker) failAll(err error) {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = make(map[uint64]*pendingPublish)
+	for range pending {
+		<-t.slots
+	}
+	t.mu.Unlock()
+	for _, p := range pending {
+		p.future.resolve(err)
+	}
+}
+
+func (t *confirmTracker) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pending)
+}
@@ -0,0 +1,153 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfirmTracker(t *testing.T) {
+	tracker := newConfirmTracker(3, 50*time.Millisecond)
+	var tag uint64
+	track := func() *PublishFuture {
+		tracker.slots <- struct{}{}
+		f := newPublishFuture()
+		require.NoError(t, tracker.publish(f, func() (uint64, error) {
+			tag++
+			return tag, nil
+		}))
+		return f
+	}
+
+	f1, f2, f3 := track(), track(), track()
+	require.Equal(t, 3, tracker.len())
+
+	//確認可不依發送順序抵達
+	var callbackErr error
+	called := make(chan struct{})
+	f2.OnComplete(func(err error) {
+		callbackErr = err
+		close(called)
+	})
+	tracker.confirm(amqp.Confirmation{DeliveryTag: 2, Ack: false})
+	<-called
+	require.ErrorIs(t, callbackErr, ErrPublishNacked)
+	tracker.confirm(amqp.Confirmation{DeliveryTag: 1, Ack: true})
+	require.NoError(t, f1.Wait(context.Background()))
+
+	//逾時後到達的確認忽略
+	tracker.expire(time.Now().Add(time.Second))
+	require.ErrorIs(t, f3.Wait(context.Background()), ErrConfirmTimeout)
+	tracker.confirm(amqp.Confirmation{DeliveryTag: 3, Ack: true})
+	require.ErrorIs(t, f3.Err(), ErrConfirmTimeout)
+	require.Len(t, tracker.slots, 0)
+
+	//發送失敗時釋放slot
+	tracker.slots <- struct{}{}
+	err := tracker.publish(newPublishFuture(), func() (uint64, error) {
+		return 0, errors.New("channel closed")
+	})
+	require.Error(t, err)
+	require.Len(t, tracker.slots, 0)
+
+	f4 := track()
+	tracker.failAll(ErrChannelClosed)
+	require.ErrorIs(t, f4.Err(), ErrChannelClosed)
+	require.Equal(t, 0, tracker.len())
+	require.Len(t, tracker.slots, 0)
+}
+
+func TestThreadSafeProducerPublishBatch(t *testing.T) {
+	p := &ThreadSafeProducer{
+		BaseClient: NewBaseClient("test"),
+		msgChan:    make(chan publishRequest, 2),
+	}
+
+	_, err := p.PublishBatch(context.Background(), "", "key", [][]byte{{1}})
+	require.Error(t, err)
+
+	//佇列只能放2筆，其餘在ctx結束時以ctx錯誤完成
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	futures, err := p.PublishBatch(ctx, "exchange", "key", [][]byte{{1}, {2}, {3}, {4}})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Len(t, futures, 4)
+	require.Len(t, p.msgChan, 2)
+	for _, f := range futures[2:] {
+		require.ErrorIs(t, f.Wait(context.Background()), context.DeadlineExceeded)
+	}
+	select {
+	case <-futures[0].Done():
+		t.Fatal("queued message should not be resolved")
+	default:
+	}
+
+	req := <-p.msgChan
+	require.Equal(t, []byte{1}, req.message)
+	require.Same(t, futures[0], req.future)
+
+	_, err = p.PublishAsync("exchange", "key", []byte{5})
+	require.NoError(t, err)
+	_, err = p.PublishAsync("exchange", "key", []byte{6})
+	require.ErrorIs(t, err, ErrProducerFull)
+}
+
+func TestThreadSafeProducerPublishErrors(t *testing.T) {
+	p := &ThreadSafeProducer{BaseClient: NewBaseClient("test"), msgChan: make(chan publishRequest, 1)}
+	require.NoError(t, p.Publish("ex", "key", []byte("1")))
+	require.ErrorIs(t, p.Publish("ex", "key", []byte("2")), ErrProducerFull)
+	_, err := p.PublishAsync("ex", "key", []byte("3"))
+	require.ErrorIs(t, err, ErrProducerFull)
+
+	close(p.done)
+	require.ErrorIs(t, p.Publish("ex", "key", []byte("4")), ErrProducerClosed)
+	_, err = p.PublishAsync("ex", "key", []byte("5"))
+	require.ErrorIs(t, err, ErrProducerClosed)
+}
+
+func TestThreadSafeProducerAcquireSlotWhileClosing(t *testing.T) {
+	p := &ThreadSafeProducer{BaseClient: NewBaseClient("test"), confirmTimeout: 50 * time.Millisecond}
+	close(p.done)
+
+	//關閉中flush時有名額一定取得
+	tracker := newConfirmTracker(1, time.Second)
+	for i := 0; i < 100; i++ {
+		require.True(t, p.acquireSlot(tracker))
+		<-tracker.slots
+	}
+
+	//名額已滿時等待確認釋放
+	tracker.slots <- struct{}{}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-tracker.slots
+	}()
+	require.True(t, p.acquireSlot(tracker))
+
+	//等待逾時
+	start := time.Now()
+	require.False(t, p.acquireSlot(tracker))
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestThreadSafeProducerWaitConfirm(t *testing.T) {
+	p := &ThreadSafeProducer{
+		BaseClient:     NewBaseClient("test"),
+		confirms:       make(chan amqp.Confirmation, 1),
+		confirmTimeout: 50 * time.Millisecond,
+	}
+
+	p.confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: true}
+	require.NoError(t, p.waitConfirm())
+	p.confirms <- amqp.Confirmation{DeliveryTag: 2, Ack: false}
+	require.ErrorIs(t, p.waitConfirm(), ErrPublishNacked)
+
+	//未啟用pipelining時同樣以confirmTimeout為上限
+	start := time.Now()
+	require.ErrorIs(t, p.waitConfirm(), ErrConfirmTimeout)
+	require.Less(t, time.Since(start), time.Second)
+}
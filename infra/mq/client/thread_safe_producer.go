@@ -18,17 +18,56 @@ type ThreadSafeProducer struct {
 	errChan       chan error //for publish error chan
 	confirms      chan amqp.Confirmation
 	channelNotify chan *amqp.Error
+
+	pipelined      bool //不等待確認即發送下一筆，由confirm thread對應確認結果
+	maxInFlight    int
+	confirmTimeout time.Duration
+	tracker        *confirmTracker //目前channel的等待確認訊息，只在publish thread替換
 }
 
 type publishRequest struct {
 	exchange   string
 	routingKey string
 	message    []byte
+	future     *PublishFuture //nil表示錯誤送至errChan
+}
+
+// NewThreadSafeProducer 的可選設定
+type ProducerOption func(*ThreadSafeProducer)
+
+/*
+啟用pipelining，同時最多maxInFlight筆訊息等待broker確認
+未啟用時每筆訊息等待確認後才發送下一筆
+
+	maxInFlight: <=0 視為100
+*/
+func WithPipelining(maxInFlight int) ProducerOption {
+	return func(p *ThreadSafeProducer) {
+		if maxInFlight <= 0 {
+			maxInFlight = 100
+		}
+		p.pipelined = true
+		p.maxInFlight = maxInFlight
+	}
+}
+
+// 等待broker確認的時間上限，預設20秒
+func WithConfirmTimeout(timeout time.Duration) ProducerOption {
+	return func(p *ThreadSafeProducer) {
+		if timeout > 0 {
+			p.confirmTimeout = timeout
+		}
+	}
 }
 
-func NewThreadSafeProducer(name string) (*ThreadSafeProducer, error) {
+func NewThreadSafeProducer(name string, opts ...ProducerOption) (*ThreadSafeProducer, error) {
 	producer := &ThreadSafeProducer{
-		BaseClient: NewBaseClient(name),
+		BaseClient:     NewBaseClient(name),
+		maxInFlight:    1,
+		confirmTimeout: 20 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(producer)
 	}
 
 	err := producer.setChanFromManger()
@@ -45,7 +84,7 @@ func NewThreadSafeProducer(name string) (*ThreadSafeProducer, error) {
 }
 
 func (p *ThreadSafeProducer) setProducerExtraChannel() error {
-	p.confirms = p.channel.NotifyPublish(make(chan amqp.Confirmation, 1))
+	p.confirms = p.channel.NotifyPublish(make(chan amqp.Confirmation, p.maxInFlight))
 	p.channelNotify = p.channel.NotifyClose(make(chan *amqp.Error, 1))
 	//避免清空原有資料
 	if p.msgChan == nil {
@@ -58,6 +97,11 @@ func (p *ThreadSafeProducer) setProducerExtraChannel() error {
 
 	p.chanCloseFlag.Store(false)
 
+	if p.pipelined {
+		p.tracker = newConfirmTracker(p.maxInFlight, p.confirmTimeout)
+		go p.confirmLoop(p.confirms, p.tracker, p.done)
+	}
+
 	return nil
 }
 
@@ -75,43 +119,112 @@ func (p *ThreadSafeProducer) reconnect() error {
 
 // Publish 發布訊息
 func (p *ThreadSafeProducer) Publish(exchange, routingKey string, message []byte) error {
+	if err := p.checkPublish(exchange, routingKey); err != nil {
+		return err
+	}
+
+	req := publishRequest{
+		exchange:   exchange,
+		routingKey: routingKey,
+		message:    message,
+	}
+
+	select {
+	case p.msgChan <- req:
+	default:
+		return ErrProducerFull
+	}
+
+	return nil
+}
+
+func (p *ThreadSafeProducer) checkPublish(exchange, routingKey string) error {
 	select {
 	case <-p.done:
-		return fmt.Errorf("producer is closed")
+		return ErrProducerClosed
 	default:
 	}
 
 	if exchange == "" || routingKey == "" {
 		return fmt.Errorf("invalid parameters: exchange and routingKey cannot be empty")
 	}
+	return nil
+}
+
+/*
+發布訊息並回傳發送結果，佇列已滿時回傳ErrProducerFull
+Close時尚未發送的訊息保留在佇列，ReStart後繼續發送
+*/
+func (p *ThreadSafeProducer) PublishAsync(exchange, routingKey string, message []byte) (*PublishFuture, error) {
+	if err := p.checkPublish(exchange, routingKey); err != nil {
+		return nil, err
+	}
 
 	req := publishRequest{
 		exchange:   exchange,
 		routingKey: routingKey,
 		message:    message,
+		future:     newPublishFuture(),
 	}
 
 	select {
 	case p.msgChan <- req:
 	default:
-		return fmt.Errorf("producer is full")
+		return nil, ErrProducerFull
 	}
 
-	return nil
+	return req.future, nil
+}
+
+/*
+依序發布多筆訊息，佇列已滿時等待
+ctx結束或producer關閉時，尚未進入佇列的訊息以對應錯誤完成並回傳該錯誤
+
+	return:
+		futures: 與messages順序相同
+*/
+func (p *ThreadSafeProducer) PublishBatch(ctx context.Context, exchange, routingKey string, messages [][]byte) ([]*PublishFuture, error) {
+	if err := p.checkPublish(exchange, routingKey); err != nil {
+		return nil, err
+	}
+
+	futures := make([]*PublishFuture, len(messages))
+	for i := range futures {
+		futures[i] = newPublishFuture()
+	}
+	for i, message := range messages {
+		req := publishRequest{
+			exchange:   exchange,
+			routingKey: routingKey,
+			message:    message,
+			future:     futures[i],
+		}
+		var err error
+		select {
+		case p.msgChan <- req:
+			continue
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-p.done:
+			err = ErrProducerClosed
+		}
+		for _, f := range futures[i:] {
+			f.resolve(err)
+		}
+		return futures, err
+	}
+
+	return futures, nil
 }
 
 func (p *ThreadSafeProducer) publish(exchange, routingKey string, message []byte) error {
 	// 檢查 channel 是否已關閉
 	select {
 	case <-p.done:
-		return fmt.Errorf("producer is closed")
+		return ErrProducerClosed
 	default:
 	}
 
-	// 使用 context 控制超時
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-	defer cancel()
-
 	err := p.channel.Publish(
 		exchange,   // exchange
 		routingKey, // routing key
@@ -128,13 +241,21 @@ func (p *ThreadSafeProducer) publish(exchange, routingKey string, message []byte
 		return fmt.Errorf("failed to publish message: %v", err)
 	}
 
+	return p.waitConfirm()
+}
+
+// 等待上一筆發送的確認，最多等待confirmTimeout
+func (p *ThreadSafeProducer) waitConfirm() error {
+	timer := time.NewTimer(p.confirmTimeout)
+	defer timer.Stop()
+
 	select {
 	case confirm := <-p.confirms:
 		if !confirm.Ack {
-			return fmt.Errorf("producer %s_%s failed to receive confirmation for message", p.name, p.id)
+			return fmt.Errorf("producer %s_%s: %w", p.name, p.id, ErrPublishNacked)
 		}
-	case <-ctx.Done():
-		return fmt.Errorf("producer %s_%s confirmation timeout", p.name, p.id)
+	case <-timer.C:
+		return fmt.Errorf("producer %s_%s: %w", p.name, p.id, ErrConfirmTimeout)
 	}
 
 	return nil
@@ -178,12 +299,137 @@ func (p *ThreadSafeProducer) Start() {
 					p.Close()
 					return
 				}
-				p.errChan <- p.publish(req.exchange, req.routingKey, req.message)
+				p.handleRequest(req)
 			}
 		}
 	}()
 }
 
+func (p *ThreadSafeProducer) handleRequest(req publishRequest) {
+	if p.pipelined {
+		p.publishPipelined(req)
+		return
+	}
+	err := p.publish(req.exchange, req.routingKey, req.message)
+	if req.future != nil {
+		req.future.resolve(err)
+		return
+	}
+	p.errChan <- err
+}
+
+/*
+發送後不等待確認，確認結果由confirmLoop完成
+等待確認的訊息達到maxInFlight時等待
+*/
+func (p *ThreadSafeProducer) publishPipelined(req publishRequest) {
+	future := req.future
+	if future == nil {
+		future = newPublishFuture()
+		future.OnComplete(p.reportError)
+	}
+
+	tracker := p.tracker
+	if !p.acquireSlot(tracker) {
+		future.resolve(ErrProducerClosed)
+		return
+	}
+
+	err := tracker.publish(future, func() (uint64, error) {
+		tag := p.channel.GetNextPublishSeqNo()
+		return tag, p.channel.Publish(
+			req.exchange,   // exchange
+			req.routingKey, // routing key
+			false,          // mandatory
+			false,          // immediate
+			amqp.Publishing{
+				ContentType: "application/json",
+				Body:        req.message,
+				Timestamp:   time.Now(),
+			},
+		)
+	})
+	if err != nil {
+		future.resolve(fmt.Errorf("failed to publish message: %v", err))
+	}
+}
+
+/*
+取得等待確認的名額，有名額時優先取得，關閉中flush的訊息同樣發送
+關閉後名額已滿時最多等待confirmTimeout，讓確認或逾時釋放名額
+
+	return:
+		false: 關閉後等待逾時，訊息不發送
+*/
+func (p *ThreadSafeProducer) acquireSlot(tracker *confirmTracker) bool {
+	select {
+	case tracker.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	select {
+	case tracker.slots <- struct{}{}:
+		return true
+	case <-p.done:
+	}
+	timer := time.NewTimer(p.confirmTimeout)
+	defer timer.Stop()
+	select {
+	case tracker.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+/*
+confirm thread，每個channel一個
+channel關閉時等待中的訊息以ErrChannelClosed完成
+producer關閉後繼續等待確認，直到沒有等待中的訊息或全部逾時
+*/
+func (p *ThreadSafeProducer) confirmLoop(confirms chan amqp.Confirmation, tracker *confirmTracker, done chan struct{}) {
+	interval := p.confirmTimeout / 4
+	if interval > time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	closing := false
+	for {
+		select {
+		case c, ok := <-confirms:
+			if !ok {
+				tracker.failAll(ErrChannelClosed)
+				return
+			}
+			tracker.confirm(c)
+		case now := <-ticker.C:
+			tracker.expire(now)
+		case <-done:
+			done = nil
+			closing = true
+		}
+		if closing && tracker.len() == 0 {
+			return
+		}
+	}
+}
+
+// 錯誤送至error handler，error handler已結束時直接輸出
+func (p *ThreadSafeProducer) reportError(err error) {
+	if err == nil {
+		return
+	}
+	err = fmt.Errorf("producer %s_%s publish failed: %w", p.name, p.id, err)
+	select {
+	case p.errChan <- err:
+	default:
+		p.handleError(err)
+	}
+}
+
 func (p *ThreadSafeProducer) handleError(err error) error {
 	if err != nil {
 		log.Print(err)
@@ -223,7 +469,7 @@ func (p *ThreadSafeProducer) flush(exitDuration time.Duration) error {
 	case <-timer.C:
 		return nil
 	case req := <-p.msgChan:
-		p.errChan <- p.publish(req.exchange, req.routingKey, req.message)
+		p.handleRequest(req)
 	}
 	log.Printf("producer %s_%s 清理剩餘訊息完成", p.name, p.id)
 
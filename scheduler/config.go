@@ -0,0 +1,245 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+/*
+設定檔中的任務定義
+
+	Name: 任務唯一名稱，用於比對設定變更
+	Type: 註冊的TaskFactory名稱，空字串時使用Name
+	Spec: 排程格式，見ParseSpec
+	Enabled: 未設定時視為啟用
+	Params: 傳給TaskFactory的參數，key會被轉為小寫
+*/
+type TaskDefinition struct {
+	Name    string         `mapstructure:"name" json:"name"`
+	Type    string         `mapstructure:"type" json:"type,omitempty"`
+	Spec    string         `mapstructure:"spec" json:"spec"`
+	Enabled *bool          `mapstructure:"enabled" json:"enabled,omitempty"`
+	Params  map[string]any `mapstructure:"params" json:"params,omitempty"`
+}
+
+func (d *TaskDefinition) IsEnabled() bool {
+	return d.Enabled == nil || *d.Enabled
+}
+
+func (d *TaskDefinition) factoryName() string {
+	if d.Type != "" {
+		return d.Type
+	}
+	return d.Name
+}
+
+// 依任務定義建立任務
+type TaskFactory func(def TaskDefinition) (ISchedulerTask, error)
+
+// 已套用到scheduler的任務
+type loadedTask struct {
+	id   int
+	def  TaskDefinition
+	task ISchedulerTask
+}
+
+/*
+從YAML或JSON設定檔載入任務，依副檔名判斷格式
+
+	tasks:
+	  - name: cleanup
+	    type: cleanup
+	    spec: "0 3 * * *"
+	    enabled: true
+	    params:
+	      days: 7
+
+設定檔變更時比對任務定義，以AddTask、UpdateTask、RemoveTask套用差異
+*/
+type ConfigLoader struct {
+	scheduler IScheduler
+	path      string
+	factories map[string]TaskFactory
+	tasks     map[string]*loadedTask //name -> 已套用的任務
+	watcher   *viper.Viper
+	mu        sync.Mutex
+}
+
+func NewConfigLoader(s IScheduler, path string) *ConfigLoader {
+	return &ConfigLoader{
+		scheduler: s,
+		path:      path,
+		factories: make(map[string]TaskFactory),
+		tasks:     make(map[string]*loadedTask),
+	}
+}
+
+// 註冊任務類型，需在Load前呼叫
+func (l *ConfigLoader) Register(name string, factory TaskFactory) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.factories[name] = factory
+}
+
+/*
+讀取設定檔並套用差異
+設定檔格式錯誤、任務名稱重複、未註冊的類型或排程格式錯誤時不做任何變更
+*/
+func (l *ConfigLoader) Load() error {
+	defs, err := l.read()
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.validate(defs); err != nil {
+		return err
+	}
+	return l.apply(defs)
+}
+
+/*
+監看設定檔，變更時重新載入
+used go routine inside
+
+	onError: 重新載入失敗時呼叫，可為nil
+*/
+func (l *ConfigLoader) Watch(onError func(error)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.watcher != nil {
+		return
+	}
+	l.watcher = viper.New()
+	l.watcher.SetConfigFile(l.path)
+	l.watcher.OnConfigChange(func(e fsnotify.Event) {
+		if err := l.Load(); err != nil && onError != nil {
+			onError(fmt.Errorf("reload scheduler config %s failed: %w", l.path, err))
+		}
+	})
+	l.watcher.WatchConfig()
+}
+
+// 回傳已套用任務的名稱與task id
+func (l *ConfigLoader) Tasks() map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	res := make(map[string]int, len(l.tasks))
+	for name, t := range l.tasks {
+		res[name] = t.id
+	}
+	return res
+}
+
+/*
+每次以新的viper讀取，不與監看用的viper共用狀態
+寫入中的檔案可能沒有tasks，此時視為錯誤而非移除所有任務
+*/
+func (l *ConfigLoader) read() ([]TaskDefinition, error) {
+	v := viper.New()
+	v.SetConfigFile(l.path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("read scheduler config failed: %w", err)
+	}
+	if !v.IsSet("tasks") {
+		return nil, fmt.Errorf("scheduler config %s has no tasks", l.path)
+	}
+	var defs []TaskDefinition
+	if err := v.UnmarshalKey("tasks", &defs); err != nil {
+		return nil, fmt.Errorf("decode scheduler config failed: %w", err)
+	}
+	return defs, nil
+}
+
+// 呼叫端需持有mu
+func (l *ConfigLoader) validate(defs []TaskDefinition) error {
+	names := make(map[string]struct{}, len(defs))
+	for i, def := range defs {
+		if def.Name == "" {
+			return fmt.Errorf("task %d: name is empty", i)
+		}
+		if _, ok := names[def.Name]; ok {
+			return fmt.Errorf("task %s: duplicate name", def.Name)
+		}
+		names[def.Name] = struct{}{}
+		if !def.IsEnabled() {
+			continue
+		}
+		if _, ok := l.factories[def.factoryName()]; !ok {
+			return fmt.Errorf("task %s: type %s is not registered", def.Name, def.factoryName())
+		}
+		if err := ValidateSpec(def.Spec); err != nil {
+			return fmt.Errorf("task %s: %w", def.Name, err)
+		}
+	}
+	return nil
+}
+
+/*
+套用差異，呼叫端需持有mu
+個別任務失敗時繼續處理其他任務，回傳所有錯誤
+*/
+func (l *ConfigLoader) apply(defs []TaskDefinition) error {
+	var errs []error
+	wanted := make(map[string]TaskDefinition, len(defs))
+	for _, def := range defs {
+		if def.IsEnabled() {
+			wanted[def.Name] = def
+		}
+	}
+
+	for _, name := range sortedKeys(l.tasks) {
+		if _, ok := wanted[name]; ok {
+			continue
+		}
+		if err := l.scheduler.RemoveTask(l.tasks[name].id); err != nil {
+			errs = append(errs, fmt.Errorf("task %s: remove failed: %w", name, err))
+			continue
+		}
+		delete(l.tasks, name)
+	}
+
+	for _, name := range sortedKeys(wanted) {
+		def := wanted[name]
+		loaded, exists := l.tasks[name]
+		if exists && reflect.DeepEqual(loaded.def, def) {
+			continue
+		}
+		task, err := l.factories[def.factoryName()](def)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("task %s: create failed: %w", name, err))
+			continue
+		}
+
+		var id int
+		if exists {
+			//保留原任務的執行狀態
+			task.SetStatus(loaded.task.GetStatus())
+			id, err = l.scheduler.UpdateTask(loaded.id, def.Spec, task)
+		} else {
+			id, err = l.scheduler.AddTask(def.Spec, task)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("task %s: schedule failed: %w", name, err))
+			continue
+		}
+		l.tasks[name] = &loadedTask{id: id, def: def, task: task}
+	}
+	return errors.Join(errs...)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
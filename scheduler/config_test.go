@@ -0,0 +1,103 @@
+package scheduler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type paramSchedulerTask struct {
+	BaseSchedulerTask
+	def TaskDefinition
+}
+
+func (t *paramSchedulerTask) RunSchedulerTask() {}
+
+func TestConfigLoaderReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.yaml")
+	write := func(content string) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	write(`
+tasks:
+  - name: cleanup
+    spec: "0 3 * * *"
+    params:
+      days: 7
+  - name: report
+    type: cleanup
+    spec: "@hourly"
+  - name: sync
+    spec: "@every 10m"
+    enabled: false
+`)
+
+	s := NewScheduler()
+	l := NewConfigLoader(s, path)
+	created := make(chan TaskDefinition, 10)
+	l.Register("cleanup", func(def TaskDefinition) (ISchedulerTask, error) {
+		created <- def
+		return &paramSchedulerTask{def: def}, nil
+	})
+	require.NoError(t, l.Load())
+
+	tasks := l.Tasks()
+	require.Len(t, tasks, 2)
+	info, err := s.GetTask(tasks["cleanup"])
+	require.NoError(t, err)
+	require.Equal(t, "0 3 * * *", info.Spec)
+	def := <-created
+	require.Equal(t, "cleanup", def.Name)
+	require.EqualValues(t, 7, def.Params["days"])
+
+	//錯誤的設定不做任何變更
+	write(`
+tasks:
+  - name: cleanup
+    spec: "0 25 * * *"
+`)
+	require.ErrorIs(t, l.Load(), ErrInvalidSpec)
+	write(`
+tasks:
+  - name: unknown
+    spec: "@daily"
+`)
+	require.ErrorContains(t, l.Load(), "not registered")
+	require.Equal(t, tasks, l.Tasks())
+
+	oldReport, err := s.GetTask(tasks["report"])
+	require.NoError(t, err)
+
+	l.Watch(func(err error) { t.Log(err) })
+	write(`
+tasks:
+  - name: cleanup
+    spec: "0 4 * * *"
+    params:
+      days: 7
+  - name: report
+    type: cleanup
+    spec: "@hourly"
+    enabled: false
+  - name: sync
+    type: cleanup
+    spec: "@every 10m"
+`)
+	require.Eventually(t, func() bool {
+		tasks := l.Tasks()
+		_, hasReport := tasks["report"]
+		_, hasSync := tasks["sync"]
+		return len(tasks) == 2 && !hasReport && hasSync
+	}, 5*time.Second, 20*time.Millisecond)
+
+	tasks = l.Tasks()
+	info, err = s.GetTask(tasks["cleanup"])
+	require.NoError(t, err)
+	require.Equal(t, "0 4 * * *", info.Spec)
+	_, err = s.GetTask(oldReport.Id)
+	require.Error(t, err)
+	require.Len(t, s.ListTasks(), 2)
+}
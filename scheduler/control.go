@@ -0,0 +1,60 @@
+package scheduler
+
+import "fmt"
+
+// 執行的觸發來源
+type RunTrigger string
+
+const (
+	TriggerCron    RunTrigger = "cron"
+	TriggerManual  RunTrigger = "manual"  //TriggerNow
+	TriggerMisfire RunTrigger = "misfire" //啟動時補執行錯過的觸發
+)
+
+// 是否為排程產生的觸發，一次性任務只在這類觸發後移除
+func (t RunTrigger) scheduled() bool {
+	return t == TriggerCron || t == TriggerMisfire
+}
+
+func (s *Scheduler) getJob(taskId int) (*schedulerJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[taskId]
+	if !ok {
+		return nil, fmt.Errorf("scheduler task %d not found", taskId)
+	}
+	return job, nil
+}
+
+// 暫停任務，排程觸發時略過，執行中的任務不受影響
+func (s *Scheduler) Pause(taskId int) error {
+	job, err := s.getJob(taskId)
+	if err != nil {
+		return err
+	}
+	job.task.GetStatus().IsPaused.Store(true)
+	return nil
+}
+
+func (s *Scheduler) Resume(taskId int) error {
+	job, err := s.getJob(taskId)
+	if err != nil {
+		return err
+	}
+	job.task.GetStatus().IsPaused.Store(false)
+	return nil
+}
+
+/*
+立即執行一次，不等待執行結束
+暫停中的任務仍會執行，套用重疊策略與重試策略，不使用執行鎖
+used go routine inside
+*/
+func (s *Scheduler) TriggerNow(taskId int) error {
+	job, err := s.getJob(taskId)
+	if err != nil {
+		return err
+	}
+	go job.run(TriggerManual)
+	return nil
+}
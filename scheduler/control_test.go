@@ -0,0 +1,74 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerPauseResumeTriggerNow(t *testing.T) {
+	history := NewMemoryRunHistoryStore(0)
+	s := NewScheduler(WithRunHistory(history))
+	task := &countSchedulerTask{}
+	id, err := s.AddTask("@every 1s", task)
+	require.NoError(t, err)
+	job, err := s.getJob(id)
+	require.NoError(t, err)
+
+	require.Error(t, s.Pause(100))
+	require.Error(t, s.TriggerNow(100))
+
+	//暫停時排程觸發略過
+	require.NoError(t, s.Pause(id))
+	info, err := s.GetTask(id)
+	require.NoError(t, err)
+	require.True(t, info.Status.IsPaused)
+	job.Run()
+	require.EqualValues(t, 0, task.GetStatus().RunCount.Load())
+
+	//暫停時仍可手動執行，與排程觸發分開計數
+	require.NoError(t, s.TriggerNow(id))
+	require.Eventually(t, func() bool {
+		runs, err := s.ListRuns(context.Background(), id, 0)
+		return err == nil && len(runs) == 1
+	}, time.Second, 10*time.Millisecond)
+	require.EqualValues(t, 1, task.GetStatus().ManualRunCount.Load())
+	require.EqualValues(t, 0, task.GetStatus().RunCount.Load())
+
+	require.NoError(t, s.Resume(id))
+	job.Run()
+	require.EqualValues(t, 1, task.GetStatus().RunCount.Load())
+	require.EqualValues(t, 1, task.GetStatus().ManualRunCount.Load())
+
+	runs, err := s.ListRuns(context.Background(), id, 0)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	require.Equal(t, TriggerCron, runs[0].Trigger)
+	require.Equal(t, TriggerManual, runs[1].Trigger)
+}
+
+func TestSchedulerTriggerNowKeepsRunAtTask(t *testing.T) {
+	s := NewScheduler()
+	task := &countSchedulerTask{}
+	id, err := s.RunAt(time.Now().Add(time.Hour), task)
+	require.NoError(t, err)
+	job, err := s.getJob(id)
+	require.NoError(t, err)
+
+	//手動執行不影響一次性任務的排程
+	require.NoError(t, s.TriggerNow(id))
+	require.Eventually(t, func() bool {
+		return task.GetStatus().ManualRunCount.Load() == 1
+	}, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	_, err = s.GetTask(id)
+	require.NoError(t, err)
+
+	//排程觸發執行後移除
+	job.Run()
+	require.EqualValues(t, 1, task.GetStatus().RunCount.Load())
+	_, err = s.GetTask(id)
+	require.Error(t, err)
+}
@@ -0,0 +1,262 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RoyceAzure/rj/repo/file"
+	rjmongo "github.com/RoyceAzure/rj/repo/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 單次執行結果
+type RunOutcome string
+
+const (
+	RunSucceeded RunOutcome = "succeeded"
+	RunFailed    RunOutcome = "failed"
+	RunSkipped   RunOutcome = "skipped" //執行鎖由其他實例持有或重疊策略略過
+)
+
+/*
+排程任務單次執行紀錄
+以TaskName查詢，TaskId為執行當時的EntryID，重啟或UpdateTask後會改變
+*/
+type RunRecord struct {
+	TaskName   string        `json:"task_name" bson:"task_name"` //taskNameOf，實作NamedSchedulerTask時跨重啟一致
+	TaskId     int           `json:"task_id" bson:"task_id"`
+	StartTime  time.Time     `json:"start_time" bson:"start_time"`
+	EndTime    time.Time     `json:"end_time" bson:"end_time"`
+	Duration   time.Duration `json:"duration" bson:"duration"`
+	Outcome    RunOutcome    `json:"outcome" bson:"outcome"`
+	Error      string        `json:"error,omitempty" bson:"error,omitempty"`
+	Attempts   int           `json:"attempts,omitempty" bson:"attempts,omitempty"`       //包含重試的執行次數
+	SkipReason string        `json:"skip_reason,omitempty" bson:"skip_reason,omitempty"` //Outcome為RunSkipped時略過的原因
+	Trigger    RunTrigger    `json:"trigger,omitempty" bson:"trigger,omitempty"`
+}
+
+/*
+排程執行紀錄儲存
+*/
+type RunHistoryStore interface {
+	Record(ctx context.Context, rec RunRecord) error
+	/*
+		回傳任務最近的執行紀錄，由新到舊
+
+			taskName: RunRecord.TaskName
+			limit: <=0 表示全部
+	*/
+	ListRuns(ctx context.Context, taskName string, limit int) ([]RunRecord, error)
+}
+
+func limitRuns(runs []RunRecord, limit int) []RunRecord {
+	if limit > 0 && len(runs) > limit {
+		return runs[:limit]
+	}
+	return runs
+}
+
+// 以記憶體保存每個任務最近maxPerTask筆紀錄
+type MemoryRunHistoryStore struct {
+	runs       map[string][]RunRecord
+	maxPerTask int
+	mu         sync.RWMutex
+}
+
+/*
+maxPerTask: 每個任務保存筆數，<=0 表示不限制
+*/
+func NewMemoryRunHistoryStore(maxPerTask int) *MemoryRunHistoryStore {
+	return &MemoryRunHistoryStore{
+		runs:       make(map[string][]RunRecord),
+		maxPerTask: maxPerTask,
+	}
+}
+
+func (m *MemoryRunHistoryStore) Record(ctx context.Context, rec RunRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	runs := append(m.runs[rec.TaskName], rec)
+	if m.maxPerTask > 0 && len(runs) > m.maxPerTask {
+		runs = runs[len(runs)-m.maxPerTask:]
+	}
+	m.runs[rec.TaskName] = runs
+	return nil
+}
+
+func (m *MemoryRunHistoryStore) ListRuns(ctx context.Context, taskName string, limit int) ([]RunRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	runs := m.runs[taskName]
+	res := make([]RunRecord, len(runs))
+	for i, rec := range runs {
+		res[len(runs)-1-i] = rec
+	}
+	return limitRuns(res, limit), nil
+}
+
+/*
+以JSON lines檔案保存所有紀錄
+開啟時讀取一次檔案，在記憶體中保留每個任務最近maxPerTask筆作為查詢索引，查詢不再讀取檔案
+*/
+type FileRunHistoryStore struct {
+	dao   file.FileDAO
+	index *MemoryRunHistoryStore
+}
+
+/*
+檔案不存在時建立，所在目錄需已存在
+
+	maxPerTask: 每個任務可查詢的最近筆數，<=0 表示不限制
+*/
+func NewFileRunHistoryStore(path string, maxPerTask int) (*FileRunHistoryStore, error) {
+	dao, err := file.NewTxtFileDAO(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &FileRunHistoryStore{dao: dao, index: NewMemoryRunHistoryStore(maxPerTask)}
+	if err := f.load(); err != nil {
+		dao.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// 讀取檔案中的紀錄建立索引
+func (f *FileRunHistoryStore) load() error {
+	lines, err := f.dao.Read()
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		var rec RunRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return fmt.Errorf("decode run record failed: %w", err)
+		}
+		f.index.Record(context.Background(), rec)
+	}
+	return nil
+}
+
+func (f *FileRunHistoryStore) Record(ctx context.Context, rec RunRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err := f.dao.Append(string(b)); err != nil {
+		return err
+	}
+	return f.index.Record(ctx, rec)
+}
+
+func (f *FileRunHistoryStore) ListRuns(ctx context.Context, taskName string, limit int) ([]RunRecord, error) {
+	return f.index.ListRuns(ctx, taskName, limit)
+}
+
+func (f *FileRunHistoryStore) Close() error {
+	return f.dao.Close()
+}
+
+const (
+	RUN_HISTORY_DATABASE   = "scheduler"
+	RUN_HISTORY_COLLECTION = "run_history"
+)
+
+// 以MongoDB collection保存所有紀錄
+type MongoRunHistoryStore struct {
+	collection *mongo.Collection
+}
+
+/*
+使用client的database.collection保存紀錄，並建立task_name與start_time索引
+
+	database, collection: 空字串時使用RUN_HISTORY_DATABASE、RUN_HISTORY_COLLECTION
+*/
+func NewMongoRunHistoryStore(ctx context.Context, client *mongo.Client, database, collection string) (*MongoRunHistoryStore, error) {
+	if client == nil {
+		return nil, fmt.Errorf("mongo client is empty")
+	}
+	if database == "" {
+		database = RUN_HISTORY_DATABASE
+	}
+	if collection == "" {
+		collection = RUN_HISTORY_COLLECTION
+	}
+	coll := client.Database(database).Collection(collection)
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "task_name", Value: 1}, {Key: "start_time", Value: -1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoRunHistoryStore{collection: coll}, nil
+}
+
+// 以repo/mongo.ConnectToMongo連線後建立store
+func NewMongoRunHistoryStoreFromAddress(ctx context.Context, address, database, collection string) (*MongoRunHistoryStore, error) {
+	client, err := rjmongo.ConnectToMongo(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewMongoRunHistoryStore(ctx, client, database, collection)
+}
+
+func (m *MongoRunHistoryStore) Record(ctx context.Context, rec RunRecord) error {
+	_, err := m.collection.InsertOne(ctx, rec)
+	return err
+}
+
+func (m *MongoRunHistoryStore) ListRuns(ctx context.Context, taskName string, limit int) ([]RunRecord, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "start_time", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	cursor, err := m.collection.Find(ctx, bson.D{{Key: "task_name", Value: taskName}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var res []RunRecord
+	if err := cursor.All(ctx, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+var (
+	_ RunHistoryStore = (*MemoryRunHistoryStore)(nil)
+	_ RunHistoryStore = (*FileRunHistoryStore)(nil)
+	_ RunHistoryStore = (*MongoRunHistoryStore)(nil)
+)
+
+/*
+回傳目前任務最近的執行紀錄，由新到舊，包含同名任務在重啟或UpdateTask前的紀錄
+沒有設定RunHistoryStore或任務不存在時回傳錯誤
+*/
+func (s *Scheduler) ListRuns(ctx context.Context, taskId int, limit int) ([]RunRecord, error) {
+	job, err := s.getJob(taskId)
+	if err != nil {
+		return nil, err
+	}
+	return s.ListTaskRuns(ctx, taskNameOf(taskId, job.task), limit)
+}
+
+/*
+以任務名稱回傳最近的執行紀錄，由新到舊，任務已移除時仍可查詢
+沒有設定RunHistoryStore時回傳錯誤
+*/
+func (s *Scheduler) ListTaskRuns(ctx context.Context, taskName string, limit int) ([]RunRecord, error) {
+	if s.history == nil {
+		return nil, fmt.Errorf("run history store not set")
+	}
+	return s.history.ListRuns(ctx, taskName, limit)
+}
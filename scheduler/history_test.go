@@ -0,0 +1,95 @@
+package scheduler
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type panicSchedulerTask struct {
+	BaseSchedulerTask
+	panic bool
+}
+
+func (t *panicSchedulerTask) RunSchedulerTask() {
+	if t.panic {
+		panic("boom")
+	}
+}
+
+func TestSchedulerRunHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runs.jsonl")
+	fileStore, err := NewFileRunHistoryStore(path, 0)
+	require.NoError(t, err)
+	defer fileStore.Close()
+
+	for _, store := range []RunHistoryStore{NewMemoryRunHistoryStore(2), fileStore} {
+		s := NewScheduler(WithRunHistory(store))
+		ok := &panicSchedulerTask{}
+		failed := &panicSchedulerTask{panic: true}
+		s.runTask(context.Background(), 1, ok, TriggerCron)
+		s.runTask(context.Background(), 1, failed, TriggerCron)
+		s.runTask(context.Background(), 1, ok, TriggerCron)
+		s.runTask(context.Background(), 2, failed, TriggerCron)
+
+		runs, err := s.ListTaskRuns(context.Background(), "task-1", 0)
+		require.NoError(t, err)
+		if _, isMemory := store.(*MemoryRunHistoryStore); isMemory {
+			require.Len(t, runs, 2)
+		} else {
+			require.Len(t, runs, 3)
+		}
+		require.Equal(t, RunSucceeded, runs[0].Outcome)
+		require.Equal(t, RunFailed, runs[1].Outcome)
+		require.Contains(t, runs[1].Error, "boom")
+		require.False(t, runs[0].StartTime.Before(runs[1].StartTime))
+
+		runs, err = s.ListTaskRuns(context.Background(), "task-2", 1)
+		require.NoError(t, err)
+		require.Len(t, runs, 1)
+		require.Equal(t, 2, runs[0].TaskId)
+	}
+
+	_, err = NewScheduler().ListTaskRuns(context.Background(), "task-1", 0)
+	require.Error(t, err)
+
+	//重新開啟時由檔案建立索引，只保留最近maxPerTask筆
+	require.NoError(t, fileStore.Close())
+	fileStore, err = NewFileRunHistoryStore(path, 2)
+	require.NoError(t, err)
+	defer fileStore.Close()
+	runs, err := fileStore.ListRuns(context.Background(), "task-1", 0)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	require.Equal(t, RunSucceeded, runs[0].Outcome)
+}
+
+type namedHistoryTask struct {
+	BaseSchedulerTask
+}
+
+func (t *namedHistoryTask) RunSchedulerTask()   {}
+func (t *namedHistoryTask) GetTaskName() string { return "report" }
+
+func TestSchedulerRunHistoryStableName(t *testing.T) {
+	history := NewMemoryRunHistoryStore(0)
+	s := NewScheduler(WithRunHistory(history))
+	task := &namedHistoryTask{}
+
+	//重新加入後EntryID改變，仍以名稱查到之前的紀錄
+	id, err := s.AddTask("@every 1h", task)
+	require.NoError(t, err)
+	s.runTask(context.Background(), id, task, TriggerManual)
+	s.RemoveTask(id)
+	id, err = s.AddTask("@every 1h", task)
+	require.NoError(t, err)
+	s.runTask(context.Background(), id, task, TriggerManual)
+
+	runs, err := s.ListRuns(context.Background(), id, 0)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	require.Equal(t, "report", runs[0].TaskName)
+	require.NotEqual(t, runs[0].TaskId, runs[1].TaskId)
+}
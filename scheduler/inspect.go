@@ -0,0 +1,114 @@
+package scheduler
+
+import (
+	"sort"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// SchedulerTaskStatus 某一時間點的數據，不含atomic欄位可直接複製與序列化
+type SchedulerTaskStatusSnapshot struct {
+	LastRun             time.Time `json:"last_run"`
+	NextRun             time.Time `json:"next_run"`
+	RunCount            int64     `json:"run_count"`
+	ManualRunCount      int64     `json:"manual_run_count"`
+	LastError           string    `json:"last_error,omitempty"`
+	IsRunning           bool      `json:"is_running"`
+	SkipCount           int64     `json:"skip_count"`
+	LastSkipped         time.Time `json:"last_skipped"`
+	ConsecutiveFailures int64     `json:"consecutive_failures"`
+	IsPaused            bool      `json:"is_paused"`
+}
+
+func (s *SchedulerTaskStatus) Snapshot() SchedulerTaskStatusSnapshot {
+	snap := SchedulerTaskStatusSnapshot{
+		RunCount:            s.RunCount.Load(),
+		ManualRunCount:      s.ManualRunCount.Load(),
+		IsRunning:           s.IsRunning.Load(),
+		SkipCount:           s.SkipCount.Load(),
+		ConsecutiveFailures: s.ConsecutiveFailures.Load(),
+		IsPaused:            s.IsPaused.Load(),
+	}
+	snap.LastRun, _ = s.LastRun.Load().(time.Time)
+	snap.NextRun, _ = s.NextRun.Load().(time.Time)
+	snap.LastSkipped, _ = s.LastSkipped.Load().(time.Time)
+	if err := s.GetLastError(); err != nil {
+		snap.LastError = err.Error()
+	}
+	return snap
+}
+
+/*
+排程任務資訊
+
+	NextRun, PrevRun: 來自cron.Entry，scheduler尚未啟動時NextRun為零值
+*/
+type SchedulerTaskInfo struct {
+	Id      int                         `json:"id"`
+	Name    string                      `json:"name"`
+	Spec    string                      `json:"spec"`
+	NextRun time.Time                   `json:"next_run"`
+	PrevRun time.Time                   `json:"prev_run"`
+	Status  SchedulerTaskStatusSnapshot `json:"status"`
+}
+
+// 回傳所有任務資訊，依id排序
+func (s *Scheduler) ListTasks() []SchedulerTaskInfo {
+	s.mu.Lock()
+	jobs := make([]*schedulerJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	s.mu.Unlock()
+
+	entries := make(map[cron.EntryID]cron.Entry, len(jobs))
+	for _, e := range s.cron.Entries() {
+		entries[e.ID] = e
+	}
+	res := make([]SchedulerTaskInfo, 0, len(jobs))
+	for _, job := range jobs {
+		res = append(res, job.info(entries[cron.EntryID(job.id.Load())]))
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Id < res[j].Id
+	})
+	return res
+}
+
+func (s *Scheduler) GetTask(taskId int) (SchedulerTaskInfo, error) {
+	job, err := s.getJob(taskId)
+	if err != nil {
+		return SchedulerTaskInfo{}, err
+	}
+	return job.info(s.cron.Entry(cron.EntryID(taskId))), nil
+}
+
+// 以cron.Entry更新NextRun後回傳任務資訊
+func (j *schedulerJob) info(entry cron.Entry) SchedulerTaskInfo {
+	taskId := int(j.id.Load())
+	status := j.task.GetStatus()
+	if !entry.Next.IsZero() {
+		status.NextRun.Store(entry.Next)
+	}
+	return SchedulerTaskInfo{
+		Id:      taskId,
+		Name:    taskNameOf(taskId, j.task),
+		Spec:    j.spec,
+		NextRun: entry.Next,
+		PrevRun: entry.Prev,
+		Status:  status.Snapshot(),
+	}
+}
+
+/*
+觸發時更新NextRun，回傳目前的entry
+cron執行中時Entry經由cron的迴圈取得，此時這次觸發的Prev、Next已更新
+*/
+func (j *schedulerJob) refreshNextRun() cron.Entry {
+	entry := j.s.cron.Entry(cron.EntryID(j.id.Load()))
+	if !entry.Next.IsZero() {
+		j.task.GetStatus().NextRun.Store(entry.Next)
+	}
+	return entry
+}
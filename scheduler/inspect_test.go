@@ -0,0 +1,50 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerListTasks(t *testing.T) {
+	s := NewScheduler()
+	id1, err := s.AddTask("@every 1h", &countSchedulerTask{})
+	require.NoError(t, err)
+	task2 := &countSchedulerTask{}
+	task2.GetStatus().setLastError(errors.New("boom"))
+	id2, err := s.AddTask("*/5 * * * *", task2)
+	require.NoError(t, err)
+
+	//尚未啟動時沒有下次執行時間
+	tasks := s.ListTasks()
+	require.Len(t, tasks, 2)
+	require.Equal(t, id1, tasks[0].Id)
+	require.Equal(t, "@every 1h", tasks[0].Spec)
+	require.True(t, tasks[0].NextRun.IsZero())
+
+	s.Start()
+	defer s.Stop()
+	require.Eventually(t, func() bool {
+		info, err := s.GetTask(id1)
+		return err == nil && !info.NextRun.IsZero()
+	}, time.Second, 10*time.Millisecond)
+
+	info, err := s.GetTask(id2)
+	require.NoError(t, err)
+	require.Equal(t, "*/5 * * * *", info.Spec)
+	require.Equal(t, "task-2", info.Name)
+	require.Equal(t, "boom", info.Status.LastError)
+	require.Equal(t, info.NextRun, info.Status.NextRun)
+	next, _ := task2.GetStatus().NextRun.Load().(time.Time)
+	require.Equal(t, info.NextRun, next)
+
+	b, err := json.Marshal(info)
+	require.NoError(t, err)
+	require.Contains(t, string(b), `"spec":"*/5 * * * *"`)
+
+	_, err = s.GetTask(100)
+	require.Error(t, err)
+}
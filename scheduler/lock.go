@@ -0,0 +1,231 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+多個實例共用的執行鎖，讓同一個任務的同一次觸發只在一個實例執行
+鎖在ttl後自動失效，不會主動釋放，避免較晚觸發的實例在任務結束後重複執行
+*/
+type RunLocker interface {
+	/*
+		嘗試取得key的鎖
+
+			return:
+				acquired: false表示鎖由其他實例持有
+	*/
+	TryLock(ctx context.Context, key string, ttl time.Duration) (acquired bool, err error)
+}
+
+/*
+任務可選擇實作NamedSchedulerTask提供跨實例一致的名稱作為鎖的key
+未實作時使用cron entry id，各實例需以相同順序AddTask
+*/
+type NamedSchedulerTask interface {
+	GetTaskName() string
+}
+
+// 設定執行鎖，ttl需大於各實例觸發時間差，預設1分鐘
+func WithRunLocker(locker RunLocker, ttl time.Duration) SchedulerOption {
+	return func(s *Scheduler) {
+		if ttl <= 0 {
+			ttl = time.Minute
+		}
+		s.locker = locker
+		s.lockTTL = ttl
+	}
+}
+
+/*
+任務單次觸發的鎖key
+fireTime為排程的觸發時間，各實例的時鐘誤差不影響key
+*/
+func runLockKey(taskId int, task ISchedulerTask, fireTime time.Time) string {
+	return taskNameOf(taskId, task) + "@" + strconv.FormatInt(fireTime.Truncate(time.Second).Unix(), 10)
+}
+
+/*
+cron觸發時這次排程的觸發時間
+cron在啟動job的同一輪迴圈將entry.Prev更新為這次的排程時間，entry.Prev為零值時(未經cron觸發)以now取整秒代替
+*/
+func scheduledFireTime(entry cron.Entry, now time.Time) time.Time {
+	if !entry.Prev.IsZero() {
+		return entry.Prev
+	}
+	return now.Truncate(time.Second)
+}
+
+// 任務實作NamedSchedulerTask時使用其名稱，否則為task-{id}
+func taskNameOf(taskId int, task ISchedulerTask) string {
+	if t, ok := originTask(task).(NamedSchedulerTask); ok && t.GetTaskName() != "" {
+		return t.GetTaskName()
+	}
+	return "task-" + strconv.Itoa(taskId)
+}
+
+// 目前實例的識別，用於紀錄鎖的持有者
+func instanceId() string {
+	host, _ := os.Hostname()
+	return host + "-" + strconv.Itoa(os.Getpid())
+}
+
+/*
+以檔案實作的執行鎖，適用於同一台主機或共用目錄的多個實例
+每個key對應dir下的一個鎖檔，內容為失效時間
+*/
+type FileRunLocker struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// dir不存在時建立
+func NewFileRunLocker(dir string) (*FileRunLocker, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock dir: %v", err)
+	}
+	return &FileRunLocker{dir: dir}, nil
+}
+
+var lockFileReplacer = strings.NewReplacer("/", "_", "\\", "_", ":", "_")
+
+func (l *FileRunLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	path := filepath.Join(l.dir, lockFileReplacer.Replace(key)+".lock")
+	for i := 0; i < 2; i++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			expiresAt := time.Now().Add(ttl).UnixNano()
+			_, err = f.WriteString(strconv.FormatInt(expiresAt, 10))
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(path)
+				return false, fmt.Errorf("failed to write lock file: %v", err)
+			}
+			l.cleanup()
+			return true, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return false, fmt.Errorf("failed to create lock file: %v", err)
+		}
+		if !lockFileExpired(path) {
+			return false, nil
+		}
+		//鎖已失效，移除後再試一次
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, fmt.Errorf("failed to remove expired lock file: %v", err)
+		}
+	}
+	return false, nil
+}
+
+func lockFileExpired(path string) bool {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		//寫入中的鎖檔視為有效
+		return false
+	}
+	expiresAt, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return false
+	}
+	return time.Now().UnixNano() > expiresAt
+}
+
+// 移除已失效的鎖檔，呼叫端需持有mu
+func (l *FileRunLocker) cleanup() {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".lock") {
+			continue
+		}
+		path := filepath.Join(l.dir, e.Name())
+		if lockFileExpired(path) {
+			os.Remove(path)
+		}
+	}
+}
+
+const RUN_LOCK_COLLECTION = "run_locks"
+
+/*
+以MongoDB實作的執行鎖
+以_id作為key，失效的鎖可被覆寫，expires_at的TTL index負責清除
+*/
+type MongoRunLocker struct {
+	collection *mongo.Collection
+	owner      string
+}
+
+type runLockDoc struct {
+	Key       string    `bson:"_id"`
+	Owner     string    `bson:"owner"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+/*
+database, collection: 空字串時使用RUN_HISTORY_DATABASE、RUN_LOCK_COLLECTION
+*/
+func NewMongoRunLocker(ctx context.Context, client *mongo.Client, database, collection string) (*MongoRunLocker, error) {
+	if client == nil {
+		return nil, fmt.Errorf("mongo client is empty")
+	}
+	if database == "" {
+		database = RUN_HISTORY_DATABASE
+	}
+	if collection == "" {
+		collection = RUN_LOCK_COLLECTION
+	}
+	coll := client.Database(database).Collection(collection)
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoRunLocker{collection: coll, owner: instanceId()}, nil
+}
+
+func (l *MongoRunLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	doc := runLockDoc{Key: key, Owner: l.owner, ExpiresAt: now.Add(ttl)}
+	//只有鎖不存在或已失效時才會寫入，鎖有效時upsert會因_id重複而失敗
+	_, err := l.collection.ReplaceOne(ctx,
+		bson.D{{Key: "_id", Value: key}, {Key: "expires_at", Value: bson.D{{Key: "$lt", Value: now}}}},
+		doc,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+var (
+	_ RunLocker = (*FileRunLocker)(nil)
+	_ RunLocker = (*MongoRunLocker)(nil)
+)
@@ -0,0 +1,116 @@
+package scheduler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/require"
+)
+
+type countSchedulerTask struct {
+	BaseSchedulerTask
+}
+
+func (t *countSchedulerTask) RunSchedulerTask() {}
+
+func TestFileRunLocker(t *testing.T) {
+	dir := t.TempDir()
+	l1, err := NewFileRunLocker(dir)
+	require.NoError(t, err)
+	l2, err := NewFileRunLocker(dir)
+	require.NoError(t, err)
+
+	ok, err := l1.TryLock(context.Background(), "job@1", 50*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = l2.TryLock(context.Background(), "job@1", 50*time.Millisecond)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	time.Sleep(60 * time.Millisecond)
+	ok, err = l2.TryLock(context.Background(), "job@1", 50*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestSchedulerRunLockSkipsOtherInstances(t *testing.T) {
+	dir := t.TempDir()
+	history := NewMemoryRunHistoryStore(0)
+	newInstance := func() *Scheduler {
+		locker, err := NewFileRunLocker(dir)
+		require.NoError(t, err)
+		return NewScheduler(WithRunLocker(locker, time.Minute), WithRunHistory(history))
+	}
+	s1, s2 := newInstance(), newInstance()
+
+	t1, t2 := &countSchedulerTask{}, &countSchedulerTask{}
+	fireTime := time.Now().Truncate(time.Second)
+	require.True(t, s1.acquireRun(1, t1, fireTime))
+	require.False(t, s2.acquireRun(1, t2, fireTime.Add(300*time.Millisecond)))
+	require.EqualValues(t, 1, t2.GetStatus().SkipCount.Load())
+
+	//下一次觸發使用不同的鎖
+	require.True(t, s2.acquireRun(1, t2, fireTime.Add(time.Minute)))
+
+	runs, err := history.ListRuns(context.Background(), taskNameOf(1, t2), 0)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	require.Equal(t, RunSkipped, runs[0].Outcome)
+}
+
+func TestSchedulerRunLockClockSkew(t *testing.T) {
+	dir := t.TempDir()
+	newInstance := func() *Scheduler {
+		locker, err := NewFileRunLocker(dir)
+		require.NoError(t, err)
+		return NewScheduler(WithRunLocker(locker, time.Minute))
+	}
+	s1, s2 := newInstance(), newInstance()
+	t1, t2 := &countSchedulerTask{}, &countSchedulerTask{}
+
+	//兩個實例的時鐘分別在整秒前後觸發同一次排程
+	boundary := time.Now().Truncate(time.Second).Add(time.Second)
+	entry := cron.Entry{Prev: boundary}
+	now1, now2 := boundary.Add(-2*time.Millisecond), boundary.Add(3*time.Millisecond)
+	require.NotEqual(t, now1.Truncate(time.Second), now2.Truncate(time.Second))
+
+	require.True(t, s1.acquireRun(1, t1, scheduledFireTime(entry, now1)))
+	require.False(t, s2.acquireRun(1, t2, scheduledFireTime(entry, now2)))
+}
+
+type namedCountTask struct {
+	BaseSchedulerTask
+	runs *atomic.Int32
+}
+
+func (t *namedCountTask) RunSchedulerTask()   { t.runs.Add(1) }
+func (t *namedCountTask) GetTaskName() string { return "shared" }
+
+func TestSchedulerRunLockCronFiresOnce(t *testing.T) {
+	dir := t.TempDir()
+	var runs atomic.Int32
+	var instances []*Scheduler
+	for i := 0; i < 2; i++ {
+		locker, err := NewFileRunLocker(dir)
+		require.NoError(t, err)
+		s := NewScheduler(WithRunLocker(locker, time.Minute))
+		_, err = s.AddTask("* * * * * *", &namedCountTask{runs: &runs})
+		require.NoError(t, err)
+		instances = append(instances, s)
+	}
+	start := time.Now()
+	for _, s := range instances {
+		s.Start()
+	}
+	time.Sleep(2500 * time.Millisecond)
+	for _, s := range instances {
+		s.Stop()
+	}
+
+	//每秒觸發一次，兩個實例合計不超過經過的秒數
+	require.NotZero(t, runs.Load())
+	require.LessOrEqual(t, int(runs.Load()), int(time.Since(start)/time.Second)+1)
+}
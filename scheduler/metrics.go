@@ -0,0 +1,64 @@
+package scheduler
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/RoyceAzure/rj/util/metrics"
+)
+
+// 將各排程任務的執行次數、執行狀態與最後錯誤以Prometheus指標寫出
+func (s *Scheduler) Collect(w *metrics.Writer) {
+	s.mu.Lock()
+	ids := make([]int, 0, len(s.jobs))
+	statuses := make(map[int]*SchedulerTaskStatus, len(s.jobs))
+	for id, job := range s.jobs {
+		ids = append(ids, id)
+		statuses[id] = job.task.GetStatus()
+	}
+	s.mu.Unlock()
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		w.Counter("rj_scheduler_task_runs_total", "Number of scheduled task runs.", float64(statuses[id].RunCount.Load()), metrics.L("task_id", strconv.Itoa(id)))
+	}
+	for _, id := range ids {
+		w.Counter("rj_scheduler_task_manual_runs_total", "Number of scheduled task runs triggered manually.", float64(statuses[id].ManualRunCount.Load()), metrics.L("task_id", strconv.Itoa(id)))
+	}
+	for _, id := range ids {
+		w.Counter("rj_scheduler_task_skips_total", "Number of scheduled task runs skipped by run lock or overlap policy.", float64(statuses[id].SkipCount.Load()), metrics.L("task_id", strconv.Itoa(id)))
+	}
+	for _, id := range ids {
+		running := 0.0
+		if statuses[id].IsRunning.Load() {
+			running = 1
+		}
+		w.Gauge("rj_scheduler_task_running", "Whether the scheduled task is running.", running, metrics.L("task_id", strconv.Itoa(id)))
+	}
+	for _, id := range ids {
+		paused := 0.0
+		if statuses[id].IsPaused.Load() {
+			paused = 1
+		}
+		w.Gauge("rj_scheduler_task_paused", "Whether the scheduled task is paused.", paused, metrics.L("task_id", strconv.Itoa(id)))
+	}
+	for _, id := range ids {
+		if lastRun, ok := statuses[id].LastRun.Load().(time.Time); ok {
+			w.Gauge("rj_scheduler_task_last_run_timestamp_seconds", "Unix time of the last run.", float64(lastRun.UnixNano())/1e9, metrics.L("task_id", strconv.Itoa(id)))
+		}
+	}
+	for _, id := range ids {
+		if err := statuses[id].GetLastError(); err != nil {
+			w.Gauge("rj_scheduler_task_last_error_info", "Last error of the scheduled task, value is always 1.", 1, metrics.L("task_id", strconv.Itoa(id)), metrics.L("error", err.Error()))
+		}
+	}
+}
+
+// 回傳輸出排程指標的http.Handler
+func (s *Scheduler) MetricsHandler() http.Handler {
+	return metrics.Handler(s)
+}
+
+var _ metrics.Collector = (*Scheduler)(nil)
@@ -0,0 +1,170 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// scheduler停止期間錯過的觸發的處理方式
+type MisfireMode int
+
+const (
+	MisfireSkip    MisfireMode = iota //不補執行，紀錄一筆略過
+	MisfireRunOnce                    //啟動時補執行一次
+	MisfireRunAll                     //依序補執行每一次錯過的觸發，最多MaxRuns次
+)
+
+/*
+錯過觸發的補執行策略
+
+	MaxRuns: MisfireRunAll補執行次數上限，超過時只補執行最近的MaxRuns次，<=0 表示不限制
+*/
+type MisfirePolicy struct {
+	Mode    MisfireMode
+	MaxRuns int
+}
+
+// 任務可選擇實作MisfirePolicyTask，覆寫scheduler預設的補執行策略
+type MisfirePolicyTask interface {
+	GetMisfirePolicy() *MisfirePolicy
+}
+
+/*
+設定預設補執行策略，預設不處理錯過的觸發
+Start時以SchedulerTaskStatus.LastRun計算錯過的觸發
+LastRun為零值時，實作NamedSchedulerTask的任務由RunHistoryStore以名稱取得最近一次紀錄的時間
+*/
+func WithMisfirePolicy(policy *MisfirePolicy) SchedulerOption {
+	return func(s *Scheduler) {
+		s.misfirePolicy = policy
+	}
+}
+
+/*
+計算last之後、now之前的觸發時間
+
+	limit: 只保留最近的limit個，<=0 表示全部
+	return:
+		missed: 由舊到新
+		total: 錯過的總次數
+*/
+func missedFireTimes(schedule cron.Schedule, last, now time.Time, limit int) (missed []time.Time, total int) {
+	for t := schedule.Next(last); !t.IsZero() && t.Before(now); t = schedule.Next(t) {
+		total++
+		missed = append(missed, t)
+		if limit > 0 && len(missed) > limit {
+			missed = missed[1:]
+		}
+	}
+	return missed, total
+}
+
+// 對每個任務檢查錯過的觸發
+func (s *Scheduler) catchUpMisfires(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		go job.catchUp(now)
+	}
+}
+
+// 依補執行策略處理LastRun到now之間錯過的觸發，暫停中的任務不處理
+func (j *schedulerJob) catchUp(now time.Time) {
+	policy := j.s.misfirePolicy
+	if t, ok := originTask(j.task).(MisfirePolicyTask); ok {
+		if p := t.GetMisfirePolicy(); p != nil {
+			policy = p
+		}
+	}
+	if o, ok := j.schedule.(onceSchedule); ok {
+		j.catchUpOnce(o.at, now, policy)
+		return
+	}
+	status := j.task.GetStatus()
+	last, _ := status.LastRun.Load().(time.Time)
+	if last.IsZero() && policy != nil {
+		last = j.lastRunFromHistory()
+	}
+	if policy == nil || j.schedule == nil || last.IsZero() || status.IsPaused.Load() {
+		return
+	}
+
+	limit := 0
+	switch policy.Mode {
+	case MisfireRunOnce:
+		limit = 1
+	case MisfireRunAll:
+		limit = policy.MaxRuns
+	}
+	missed, total := missedFireTimes(j.schedule, last, now, limit)
+	if total == 0 {
+		return
+	}
+
+	taskId := int(j.id.Load())
+	switch policy.Mode {
+	case MisfireRunOnce:
+	case MisfireRunAll:
+		if total > len(missed) {
+			j.s.skipRun(taskId, j.task, fmt.Sprintf("missed %d runs exceeding misfire limit %d", total-len(missed), policy.MaxRuns))
+		}
+	default:
+		j.s.skipRun(taskId, j.task, fmt.Sprintf("missed %d runs while scheduler was stopped", total))
+		return
+	}
+	//以錯過的觸發時間取得執行鎖，多個實例只補執行一次
+	for _, fireTime := range missed {
+		if j.s.acquireRun(taskId, j.task, fireTime) {
+			j.run(TriggerMisfire)
+		}
+	}
+}
+
+/*
+RunAt的任務在scheduler啟動前或停止期間錯過執行時間，cron不會再觸發
+有補執行策略時立即補執行一次，否則紀錄略過並移除任務
+*/
+func (j *schedulerJob) catchUpOnce(at, now time.Time, policy *MisfirePolicy) {
+	if now.Before(at) {
+		return
+	}
+	taskId := int(j.id.Load())
+	if policy == nil || policy.Mode == MisfireSkip || j.task.GetStatus().IsPaused.Load() {
+		j.s.skipRun(taskId, j.task, fmt.Sprintf("missed run at %s while scheduler was stopped", at.Format(time.RFC3339)))
+		j.s.removeTask(taskId)
+		return
+	}
+	if j.s.acquireRun(taskId, j.task, at) {
+		j.run(TriggerMisfire)
+		return
+	}
+	j.s.removeTask(taskId)
+}
+
+/*
+由執行紀錄取得最近一次觸發的時間，包含略過的觸發
+只處理實作NamedSchedulerTask的任務，task-{id}在重新啟動後可能對應不同任務
+*/
+func (j *schedulerJob) lastRunFromHistory() time.Time {
+	if j.s.history == nil {
+		return time.Time{}
+	}
+	if _, ok := originTask(j.task).(NamedSchedulerTask); !ok {
+		return time.Time{}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	taskId := int(j.id.Load())
+	runs, err := j.s.history.ListRuns(ctx, taskNameOf(taskId, j.task), 1)
+	if err != nil {
+		fmt.Printf("load scheduler task %d last run failed, err : %v\n", taskId, err)
+		return time.Time{}
+	}
+	if len(runs) == 0 {
+		return time.Time{}
+	}
+	return runs[0].StartTime
+}
@@ -0,0 +1,148 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/require"
+)
+
+type misfireSchedulerTask struct {
+	BaseSchedulerTask
+	policy *MisfirePolicy
+}
+
+func (t *misfireSchedulerTask) RunSchedulerTask()                {}
+func (t *misfireSchedulerTask) GetMisfirePolicy() *MisfirePolicy { return t.policy }
+
+func TestMissedFireTimes(t *testing.T) {
+	last := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	schedule := cron.Every(time.Hour)
+
+	missed, total := missedFireTimes(schedule, last, last.Add(3*time.Hour+time.Minute), 0)
+	require.Equal(t, 3, total)
+	require.Equal(t, []time.Time{last.Add(time.Hour), last.Add(2 * time.Hour), last.Add(3 * time.Hour)}, missed)
+
+	//只保留最近的limit個
+	missed, total = missedFireTimes(schedule, last, last.Add(3*time.Hour+time.Minute), 2)
+	require.Equal(t, 3, total)
+	require.Equal(t, []time.Time{last.Add(2 * time.Hour), last.Add(3 * time.Hour)}, missed)
+
+	_, total = missedFireTimes(schedule, last, last.Add(30*time.Minute), 0)
+	require.Equal(t, 0, total)
+}
+
+func TestSchedulerMisfireCatchUp(t *testing.T) {
+	history := NewMemoryRunHistoryStore(0)
+	s := NewScheduler(WithRunHistory(history), WithMisfirePolicy(&MisfirePolicy{Mode: MisfireSkip}))
+
+	//LastRun為3.5小時前，每小時執行的任務錯過3次
+	lastRun := time.Now().UTC().Add(-3*time.Hour - 30*time.Minute)
+	newTask := func(policy *MisfirePolicy) *misfireSchedulerTask {
+		task := &misfireSchedulerTask{policy: policy}
+		task.GetStatus().LastRun.Store(lastRun)
+		return task
+	}
+	skip := newTask(nil)
+	once := newTask(&MisfirePolicy{Mode: MisfireRunOnce})
+	all := newTask(&MisfirePolicy{Mode: MisfireRunAll, MaxRuns: 2})
+	fresh := &misfireSchedulerTask{policy: &MisfirePolicy{Mode: MisfireRunAll}}
+	paused := newTask(&MisfirePolicy{Mode: MisfireRunAll})
+	paused.GetStatus().IsPaused.Store(true)
+
+	ids := make(map[*misfireSchedulerTask]int)
+	for _, task := range []*misfireSchedulerTask{skip, once, all, fresh, paused} {
+		id, err := s.AddTask("@every 1h", task)
+		require.NoError(t, err)
+		ids[task] = id
+	}
+
+	s.Start()
+	defer s.Stop()
+
+	listRuns := func(task *misfireSchedulerTask) []RunRecord {
+		runs, err := s.ListRuns(context.Background(), ids[task], 0)
+		require.NoError(t, err)
+		return runs
+	}
+	require.Eventually(t, func() bool {
+		return len(listRuns(skip)) == 1 && len(listRuns(once)) == 1 && len(listRuns(all)) == 3
+	}, 2*time.Second, 10*time.Millisecond)
+
+	runs := listRuns(skip)
+	require.Equal(t, RunSkipped, runs[0].Outcome)
+	require.Contains(t, runs[0].SkipReason, "missed 3 runs")
+
+	runs = listRuns(once)
+	require.Equal(t, TriggerMisfire, runs[0].Trigger)
+	require.EqualValues(t, 1, once.GetStatus().RunCount.Load())
+
+	//超過上限的1次略過，補執行最近的2次
+	runs = listRuns(all)
+	require.Equal(t, RunSkipped, runs[2].Outcome)
+	require.Equal(t, TriggerMisfire, runs[0].Trigger)
+	require.Equal(t, TriggerMisfire, runs[1].Trigger)
+	require.EqualValues(t, 2, all.GetStatus().RunCount.Load())
+
+	require.Empty(t, listRuns(fresh))
+	require.Empty(t, listRuns(paused))
+}
+
+func TestSchedulerRunAtMissedBeforeStart(t *testing.T) {
+	history := NewMemoryRunHistoryStore(0)
+	s := NewScheduler(WithRunHistory(history))
+	at := time.Now().Add(100 * time.Millisecond)
+	run := &misfireSchedulerTask{policy: &MisfirePolicy{Mode: MisfireRunOnce}}
+	runId, err := s.RunAt(at, run)
+	require.NoError(t, err)
+	drop := &misfireSchedulerTask{}
+	dropId, err := s.RunAt(at, drop)
+	require.NoError(t, err)
+
+	//啟動前已過執行時間
+	time.Sleep(200 * time.Millisecond)
+	s.Start()
+	defer s.Stop()
+
+	require.Eventually(t, func() bool {
+		_, err1 := s.GetTask(runId)
+		_, err2 := s.GetTask(dropId)
+		return err1 != nil && err2 != nil
+	}, 3*time.Second, 10*time.Millisecond)
+	require.EqualValues(t, 1, run.GetStatus().RunCount.Load())
+	require.Zero(t, drop.GetStatus().RunCount.Load())
+	require.EqualValues(t, 1, drop.GetStatus().SkipCount.Load())
+
+	runs, err := history.ListRuns(context.Background(), taskNameOf(runId, run), 0)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	require.Equal(t, TriggerMisfire, runs[0].Trigger)
+}
+
+func TestSchedulerMisfireLastRunFromHistory(t *testing.T) {
+	history := NewMemoryRunHistoryStore(0)
+	require.NoError(t, history.Record(context.Background(), RunRecord{
+		TaskName:  "report",
+		TaskId:    99,
+		StartTime: time.Now().UTC().Add(-2*time.Hour - 30*time.Minute),
+		Outcome:   RunSucceeded,
+		Trigger:   TriggerCron,
+	}))
+
+	//重新啟動後LastRun為零值，以名稱由執行紀錄還原
+	s := NewScheduler(WithRunHistory(history), WithMisfirePolicy(&MisfirePolicy{Mode: MisfireRunOnce}))
+	task := &namedHistoryTask{}
+	id, err := s.AddTask("@every 1h", task)
+	require.NoError(t, err)
+	s.Start()
+	defer s.Stop()
+
+	require.Eventually(t, func() bool {
+		return task.GetStatus().RunCount.Load() == 1
+	}, 3*time.Second, 10*time.Millisecond)
+	runs, err := s.ListRuns(context.Background(), id, 1)
+	require.NoError(t, err)
+	require.Equal(t, TriggerMisfire, runs[0].Trigger)
+}
@@ -6,6 +6,7 @@ package mockscheduler
 
 import (
 	reflect "reflect"
+	time "time"
 
 	scheduler "github.com/RoyceAzure/rj/scheduler"
 	gomock "github.com/golang/mock/gomock"
@@ -110,6 +111,64 @@ func (mr *MockISchedulerMockRecorder) AddTask(time, task interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddTask", reflect.TypeOf((*MockIScheduler)(nil).AddTask), time, task)
 }
 
+// AddTaskV2 mocks base method.
+func (m *MockIScheduler) AddTaskV2(time string, task scheduler.ISchedulerTaskV2) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddTaskV2", time, task)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddTaskV2 indicates an expected call of AddTaskV2.
+func (mr *MockISchedulerMockRecorder) AddTaskV2(time, task interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddTaskV2", reflect.TypeOf((*MockIScheduler)(nil).AddTaskV2), time, task)
+}
+
+// GetTask mocks base method.
+func (m *MockIScheduler) GetTask(taskId int) (scheduler.SchedulerTaskInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTask", taskId)
+	ret0, _ := ret[0].(scheduler.SchedulerTaskInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTask indicates an expected call of GetTask.
+func (mr *MockISchedulerMockRecorder) GetTask(taskId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTask", reflect.TypeOf((*MockIScheduler)(nil).GetTask), taskId)
+}
+
+// ListTasks mocks base method.
+func (m *MockIScheduler) ListTasks() []scheduler.SchedulerTaskInfo {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListTasks")
+	ret0, _ := ret[0].([]scheduler.SchedulerTaskInfo)
+	return ret0
+}
+
+// ListTasks indicates an expected call of ListTasks.
+func (mr *MockISchedulerMockRecorder) ListTasks() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTasks", reflect.TypeOf((*MockIScheduler)(nil).ListTasks))
+}
+
+// Pause mocks base method.
+func (m *MockIScheduler) Pause(taskId int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Pause", taskId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Pause indicates an expected call of Pause.
+func (mr *MockISchedulerMockRecorder) Pause(taskId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pause", reflect.TypeOf((*MockIScheduler)(nil).Pause), taskId)
+}
+
 // RemoveTask mocks base method.
 func (m *MockIScheduler) RemoveTask(taskId int) error {
 	m.ctrl.T.Helper()
@@ -124,6 +183,50 @@ func (mr *MockISchedulerMockRecorder) RemoveTask(taskId interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveTask", reflect.TypeOf((*MockIScheduler)(nil).RemoveTask), taskId)
 }
 
+// Resume mocks base method.
+func (m *MockIScheduler) Resume(taskId int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Resume", taskId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Resume indicates an expected call of Resume.
+func (mr *MockISchedulerMockRecorder) Resume(taskId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resume", reflect.TypeOf((*MockIScheduler)(nil).Resume), taskId)
+}
+
+// RunAt mocks base method.
+func (m *MockIScheduler) RunAt(at time.Time, task scheduler.ISchedulerTask) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RunAt", at, task)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RunAt indicates an expected call of RunAt.
+func (mr *MockISchedulerMockRecorder) RunAt(at, task interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunAt", reflect.TypeOf((*MockIScheduler)(nil).RunAt), at, task)
+}
+
+// RunEvery mocks base method.
+func (m *MockIScheduler) RunEvery(interval time.Duration, task scheduler.ISchedulerTask) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RunEvery", interval, task)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RunEvery indicates an expected call of RunEvery.
+func (mr *MockISchedulerMockRecorder) RunEvery(interval, task interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunEvery", reflect.TypeOf((*MockIScheduler)(nil).RunEvery), interval, task)
+}
+
 // Start mocks base method.
 func (m *MockIScheduler) Start() {
 	m.ctrl.T.Helper()
@@ -148,6 +251,20 @@ func (mr *MockISchedulerMockRecorder) Stop() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockIScheduler)(nil).Stop))
 }
 
+// TriggerNow mocks base method.
+func (m *MockIScheduler) TriggerNow(taskId int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TriggerNow", taskId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TriggerNow indicates an expected call of TriggerNow.
+func (mr *MockISchedulerMockRecorder) TriggerNow(taskId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TriggerNow", reflect.TypeOf((*MockIScheduler)(nil).TriggerNow), taskId)
+}
+
 // UpdateTask mocks base method.
 func (m *MockIScheduler) UpdateTask(taskId int, time string, task scheduler.ISchedulerTask) (int, error) {
 	m.ctrl.T.Helper()
@@ -0,0 +1,172 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// 任務上一次執行尚未結束時，新觸發的處理方式
+type OverlapPolicy int
+
+const (
+	OverlapAllow          OverlapPolicy = iota //照常執行，可能同時有多個執行
+	OverlapSkip                                //略過這次觸發
+	OverlapQueueOne                            //保留一次觸發，上一次結束後立即執行，多餘的觸發略過
+	OverlapCancelPrevious                      //取消上一次執行的ctx，等待其結束後執行
+)
+
+/*
+支援ctx的排程任務，實作時scheduler呼叫RunWithContext而非RunSchedulerTask
+ctx在OverlapCancelPrevious取消上一次執行或Scheduler.Stop時被取消
+*/
+type IContextSchedulerTask interface {
+	ISchedulerTask
+	RunWithContext(ctx context.Context)
+}
+
+// 任務可選擇實作OverlapPolicyTask，覆寫scheduler預設的重疊策略
+type OverlapPolicyTask interface {
+	GetOverlapPolicy() OverlapPolicy
+}
+
+// 設定預設重疊策略，預設為OverlapAllow
+func WithOverlapPolicy(policy OverlapPolicy) SchedulerOption {
+	return func(s *Scheduler) {
+		s.overlap = policy
+	}
+}
+
+// 一次執行
+type jobRun struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+	trigger RunTrigger
+}
+
+// cron job，id在加入cron後才確定
+type schedulerJob struct {
+	s        *Scheduler
+	id       atomic.Int64
+	task     ISchedulerTask
+	spec     string
+	schedule cron.Schedule
+	once     bool //RunAt加入，執行後移除
+	policy   OverlapPolicy
+	runs     map[*jobRun]struct{} //執行中
+	queued   RunTrigger           //OverlapQueueOne保留的觸發，空字串表示沒有
+	mu       sync.Mutex
+}
+
+func (s *Scheduler) newSchedulerJob(spec string, task ISchedulerTask) *schedulerJob {
+	policy := s.overlap
+	if t, ok := originTask(task).(OverlapPolicyTask); ok {
+		policy = t.GetOverlapPolicy()
+	}
+	return &schedulerJob{
+		s:      s,
+		task:   task,
+		spec:   spec,
+		policy: policy,
+		runs:   make(map[*jobRun]struct{}),
+	}
+}
+
+// cron觸發，任務暫停時略過，以排程的觸發時間取得執行鎖
+func (j *schedulerJob) Run() {
+	entry := j.refreshNextRun()
+	if j.task.GetStatus().IsPaused.Load() {
+		return
+	}
+	if !j.s.acquireRun(int(j.id.Load()), j.task, scheduledFireTime(entry, time.Now())) {
+		return
+	}
+	j.run(TriggerCron)
+}
+
+func (j *schedulerJob) run(trigger RunTrigger) {
+	taskId := int(j.id.Load())
+	//一次性任務在排程觸發處理完後移除，TriggerNow不移除
+	remove := j.once && trigger.scheduled()
+	defer func() {
+		if remove {
+			j.s.removeTask(taskId)
+		}
+	}()
+	j.mu.Lock()
+	var prev []*jobRun
+	if len(j.runs) > 0 {
+		switch j.policy {
+		case OverlapSkip:
+			j.mu.Unlock()
+			j.s.skipRun(taskId, j.task, "previous run still running")
+			return
+		case OverlapQueueOne:
+			queued := j.queued != ""
+			if !queued {
+				j.queued = trigger
+				//由執行中的呼叫執行排隊的觸發後移除
+				remove = false
+			}
+			j.mu.Unlock()
+			if queued {
+				j.s.skipRun(taskId, j.task, "previous run still running and one run already queued")
+			}
+			return
+		case OverlapCancelPrevious:
+			prev = make([]*jobRun, 0, len(j.runs))
+			for r := range j.runs {
+				r.cancel()
+				prev = append(prev, r)
+			}
+		}
+	}
+	//先登記再等待上一次結束，之後的觸發會取消這次尚未開始的執行
+	run := j.start(trigger)
+	j.mu.Unlock()
+	for _, r := range prev {
+		<-r.done
+	}
+
+	for run != nil {
+		if run.ctx.Err() != nil {
+			j.s.skipRun(taskId, j.task, "canceled before start")
+		} else {
+			j.s.runTask(run.ctx, taskId, j.task, run.trigger)
+		}
+		run.cancel()
+
+		j.mu.Lock()
+		delete(j.runs, run)
+		close(run.done)
+		run = nil
+		if j.queued != "" {
+			run = j.start(j.queued)
+			remove = remove || (j.once && j.queued.scheduled())
+			j.queued = ""
+		}
+		j.mu.Unlock()
+	}
+}
+
+// 登記一次執行，呼叫端需持有mu
+func (j *schedulerJob) start(trigger RunTrigger) *jobRun {
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &jobRun{ctx: ctx, cancel: cancel, done: make(chan struct{}), trigger: trigger}
+	j.runs[run] = struct{}{}
+	return run
+}
+
+// 取消所有執行中的ctx
+func (j *schedulerJob) cancelRuns() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.queued = ""
+	for r := range j.runs {
+		r.cancel()
+	}
+}
@@ -0,0 +1,146 @@
+package scheduler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type blockingSchedulerTask struct {
+	BaseSchedulerTask
+	policy   OverlapPolicy
+	started  chan struct{}
+	release  chan struct{}
+	canceled atomic.Int32
+}
+
+func newBlockingSchedulerTask(policy OverlapPolicy) *blockingSchedulerTask {
+	return &blockingSchedulerTask{
+		policy:  policy,
+		started: make(chan struct{}, 10),
+		release: make(chan struct{}),
+	}
+}
+
+func (t *blockingSchedulerTask) RunSchedulerTask()               {}
+func (t *blockingSchedulerTask) GetOverlapPolicy() OverlapPolicy { return t.policy }
+func (t *blockingSchedulerTask) RunWithContext(ctx context.Context) {
+	t.started <- struct{}{}
+	select {
+	case <-t.release:
+	case <-ctx.Done():
+		t.canceled.Add(1)
+	}
+}
+
+func runJobAsync(job *schedulerJob) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		job.Run()
+		close(done)
+	}()
+	return done
+}
+
+func TestSchedulerOverlapPolicy(t *testing.T) {
+	s := NewScheduler()
+	wait := func(ch chan struct{}) {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+
+	//skip: 執行中的觸發直接略過
+	task := newBlockingSchedulerTask(OverlapSkip)
+	job := s.newSchedulerJob("@every 1h", task)
+	first := runJobAsync(job)
+	<-task.started
+	job.Run()
+	require.EqualValues(t, 1, task.GetStatus().SkipCount.Load())
+	close(task.release)
+	wait(first)
+	require.EqualValues(t, 1, task.GetStatus().RunCount.Load())
+
+	//queue-one: 保留一次觸發，多餘的略過
+	task = newBlockingSchedulerTask(OverlapQueueOne)
+	job = s.newSchedulerJob("@every 1h", task)
+	first = runJobAsync(job)
+	<-task.started
+	job.Run()
+	job.Run()
+	require.EqualValues(t, 1, task.GetStatus().SkipCount.Load())
+	close(task.release)
+	wait(first)
+	require.EqualValues(t, 2, task.GetStatus().RunCount.Load())
+
+	//cancel-previous: 取消上一次執行後再執行
+	task = newBlockingSchedulerTask(OverlapCancelPrevious)
+	job = s.newSchedulerJob("@every 1h", task)
+	first = runJobAsync(job)
+	<-task.started
+	second := runJobAsync(job)
+	wait(first)
+	<-task.started
+	require.EqualValues(t, 1, task.canceled.Load())
+	close(task.release)
+	wait(second)
+	require.EqualValues(t, 2, task.GetStatus().RunCount.Load())
+}
+
+// 取消後延遲結束，紀錄同時執行的最大數量
+type slowCancelTask struct {
+	BaseSchedulerTask
+	started   chan struct{}
+	release   chan struct{}
+	active    atomic.Int32
+	maxActive atomic.Int32
+}
+
+func (t *slowCancelTask) RunSchedulerTask()               {}
+func (t *slowCancelTask) GetOverlapPolicy() OverlapPolicy { return OverlapCancelPrevious }
+func (t *slowCancelTask) RunWithContext(ctx context.Context) {
+	n := t.active.Add(1)
+	defer t.active.Add(-1)
+	for {
+		max := t.maxActive.Load()
+		if n <= max || t.maxActive.CompareAndSwap(max, n) {
+			break
+		}
+	}
+	t.started <- struct{}{}
+	select {
+	case <-t.release:
+	case <-ctx.Done():
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSchedulerOverlapCancelPreviousConcurrent(t *testing.T) {
+	s := NewScheduler()
+	task := &slowCancelTask{started: make(chan struct{}, 10), release: make(chan struct{})}
+	job := s.newSchedulerJob("@every 1h", task)
+	runs := []chan struct{}{runJobAsync(job)}
+	<-task.started
+
+	//同時觸發多次，只有最後登記的一次執行，不可與上一次重疊
+	for i := 0; i < 4; i++ {
+		runs = append(runs, runJobAsync(job))
+	}
+	<-task.started
+	close(task.release)
+	for _, ch := range runs {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	require.EqualValues(t, 1, task.maxActive.Load())
+	require.EqualValues(t, 2, task.GetStatus().RunCount.Load())
+	require.EqualValues(t, 3, task.GetStatus().SkipCount.Load())
+}
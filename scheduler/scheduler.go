@@ -1,6 +1,7 @@
 package scheduler
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"sync/atomic"
@@ -11,6 +12,7 @@ import (
 
 /*
 cron func 簽名不回傳error  看來error要自己處理
+需要回傳error時使用ISchedulerTaskV2
 */
 type ISchedulerTask interface {
 	RunSchedulerTask()
@@ -26,71 +28,233 @@ func (b *BaseSchedulerTask) GetStatus() *SchedulerTaskStatus {
 	return &b.status
 }
 
+// SchedulerTaskStatus 內含atomic欄位不可直接複製，逐欄位寫入
 func (b *BaseSchedulerTask) SetStatus(s *SchedulerTaskStatus) {
-	b.status = *s
+	if v := s.LastRun.Load(); v != nil {
+		b.status.LastRun.Store(v)
+	}
+	if v := s.NextRun.Load(); v != nil {
+		b.status.NextRun.Store(v)
+	}
+	if v := s.LastError.Load(); v != nil {
+		b.status.LastError.Store(v)
+	}
+	if v := s.LastSkipped.Load(); v != nil {
+		b.status.LastSkipped.Store(v)
+	}
+	b.status.RunCount.Store(s.RunCount.Load())
+	b.status.ConsecutiveFailures.Store(s.ConsecutiveFailures.Load())
+	b.status.SkipCount.Store(s.SkipCount.Load())
+	b.status.IsRunning.Store(s.IsRunning.Load())
+	b.status.IsPaused.Store(s.IsPaused.Load())
+	b.status.ManualRunCount.Store(s.ManualRunCount.Load())
 }
 
 /*
 可能有多個程序會來查詢Task狀態  使用atomic
-todo memory只儲存最新一次  後續可能要寫入永久儲存
+memory只儲存最新一次，每次執行的紀錄由RunHistoryStore保存
 */
 type SchedulerTaskStatus struct {
-	LastRun   atomic.Value // stores time.Time
-	NextRun   atomic.Value // stores time.Time
-	RunCount  atomic.Int64
-	LastError atomic.Value // stores error
-	IsRunning atomic.Bool
+	LastRun             atomic.Value // stores time.Time
+	NextRun             atomic.Value // stores time.Time
+	RunCount            atomic.Int64 //排程觸發的執行次數
+	ManualRunCount      atomic.Int64 //TriggerNow手動觸發的執行次數
+	LastError           atomic.Value // stores error
+	IsRunning           atomic.Bool
+	SkipCount           atomic.Int64 //因執行鎖或重疊策略而略過的次數
+	LastSkipped         atomic.Value // stores time.Time
+	ConsecutiveFailures atomic.Int64 //連續失敗次數，成功後歸零
+	IsPaused            atomic.Bool  //暫停時排程觸發略過，TriggerNow仍可執行
+}
+
+// atomic.Value只能儲存相同型別，error統一包裝後儲存
+type lastError struct {
+	err error
+}
+
+func (e *lastError) Error() string { return e.err.Error() }
+func (e *lastError) Unwrap() error { return e.err }
+
+func (s *SchedulerTaskStatus) setLastError(err error) {
+	s.LastError.Store(&lastError{err: err})
+}
+
+// 回傳最後一次執行的錯誤，沒有時回傳nil
+func (s *SchedulerTaskStatus) GetLastError() error {
+	if e, ok := s.LastError.Load().(*lastError); ok {
+		return e.err
+	}
+	if err, ok := s.LastError.Load().(error); ok {
+		return err
+	}
+	return nil
 }
 
 type IScheduler interface {
 	AddTask(time string, task ISchedulerTask) (int, error)
+	AddTaskV2(time string, task ISchedulerTaskV2) (int, error)
 	RemoveTask(taskId int) error
 	UpdateTask(taskId int, time string, task ISchedulerTask) (int, error)
+	Pause(taskId int) error
+	Resume(taskId int) error
+	TriggerNow(taskId int) error
+	RunAt(at time.Time, task ISchedulerTask) (int, error)
+	RunEvery(interval time.Duration, task ISchedulerTask) (int, error)
+	ListTasks() []SchedulerTaskInfo
+	GetTask(taskId int) (SchedulerTaskInfo, error)
 	Start()
 	Stop()
 }
 
 type Scheduler struct {
-	cron *cron.Cron
-	mu   sync.Mutex
+	cron     *cron.Cron
+	jobs     map[int]*schedulerJob
+	location *time.Location  //預設時區
+	history  RunHistoryStore //nil表示不保存執行紀錄
+	locker   RunLocker       //nil表示不使用執行鎖
+	lockTTL  time.Duration
+	overlap  OverlapPolicy //預設重疊策略
+
+	retryPolicy     *RetryPolicy   //預設重試策略，nil表示不重試
+	misfirePolicy   *MisfirePolicy //預設補執行策略，nil表示不處理錯過的觸發
+	notifier        FailureNotifier
+	notifyThreshold int64
+	mu              sync.Mutex
 }
 
-func NewScheduler() *Scheduler {
-	return &Scheduler{
-		cron: cron.New(),
+// NewScheduler 的可選設定
+type SchedulerOption func(*Scheduler)
+
+// 設定執行紀錄儲存，每次執行完畢寫入一筆RunRecord
+func WithRunHistory(store RunHistoryStore) SchedulerOption {
+	return func(s *Scheduler) {
+		s.history = store
 	}
 }
 
+func NewScheduler(opts ...SchedulerOption) *Scheduler {
+	s := &Scheduler{
+		jobs:     make(map[int]*schedulerJob),
+		location: time.Local,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.cron = cron.New(cron.WithLocation(s.location), cron.WithParser(specParser))
+	return s
+}
+
 /*
 decorator pattern
-add new task
+依重試策略執行任務並更新狀態，執行完畢後寫入執行紀錄
+執行鎖由觸發端(cron、misfire)以排程的觸發時間取得
+任務實作IContextSchedulerTask或ISchedulerTaskV2時傳入ctx
 */
-func (s *Scheduler) wrapTask(task ISchedulerTask) func() {
-	return func() {
-		status := task.GetStatus()
-		status.LastRun.Store(time.Now().UTC())
+func (s *Scheduler) runTask(ctx context.Context, taskId int, task ISchedulerTask, trigger RunTrigger) {
+	status := task.GetStatus()
+	start := time.Now().UTC()
+	status.LastRun.Store(start)
+	if trigger == TriggerManual {
+		status.ManualRunCount.Add(1)
+	} else {
 		status.RunCount.Add(1)
-		status.IsRunning.Store(true)
-		fmt.Println("執行twse scheduler task")
-		defer func() {
-			status.IsRunning.Store(false)
+	}
+	status.IsRunning.Store(true)
+	rec := RunRecord{
+		TaskName:  taskNameOf(taskId, task),
+		TaskId:    taskId,
+		StartTime: start,
+		Outcome:   RunSucceeded,
+		Trigger:   trigger,
+	}
 
-			if r := recover(); r != nil {
-				status.LastError.Store(fmt.Errorf("panic in task: %v", r))
-			}
-		}()
-		task.RunSchedulerTask()
+	attempts, err := s.execute(ctx, task)
+	status.IsRunning.Store(false)
+	rec.Attempts = attempts
+	if err != nil {
+		status.setLastError(err)
+		rec.Outcome = RunFailed
+		rec.Error = err.Error()
+		s.taskFailed(taskId, task, err)
+	} else {
+		status.ConsecutiveFailures.Store(0)
 	}
+	s.recordRun(rec)
 }
 
-func (s *Scheduler) addTask(time string, task ISchedulerTask) (int, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+/*
+有設定執行鎖時嘗試取得這次觸發的鎖
+未取得時紀錄略過，取得鎖發生錯誤時同樣略過，避免多個實例重複執行
+*/
+func (s *Scheduler) acquireRun(taskId int, task ISchedulerTask, fireTime time.Time) bool {
+	if s.locker == nil {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	acquired, err := s.locker.TryLock(ctx, runLockKey(taskId, task, fireTime), s.lockTTL)
+	if err == nil && acquired {
+		return true
+	}
+
+	if err != nil {
+		s.skipRun(taskId, task, fmt.Sprintf("acquire run lock failed: %v", err))
+	} else {
+		s.skipRun(taskId, task, "run lock held by another instance")
+	}
+	return false
+}
+
+// 紀錄略過的觸發
+func (s *Scheduler) skipRun(taskId int, task ISchedulerTask, reason string) {
+	now := time.Now().UTC()
+	status := task.GetStatus()
+	status.SkipCount.Add(1)
+	status.LastSkipped.Store(now)
+	s.recordRun(RunRecord{
+		TaskName:   taskNameOf(taskId, task),
+		TaskId:     taskId,
+		StartTime:  now,
+		Outcome:    RunSkipped,
+		SkipReason: reason,
+	})
+}
 
-	entityId, err := s.cron.AddFunc(time, s.wrapTask(task))
+func (s *Scheduler) recordRun(rec RunRecord) {
+	if s.history == nil {
+		return
+	}
+	rec.EndTime = time.Now().UTC()
+	rec.Duration = rec.EndTime.Sub(rec.StartTime)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.history.Record(ctx, rec); err != nil {
+		fmt.Printf("record scheduler task %d run failed, err : %v\n", rec.TaskId, err)
+	}
+}
+
+func (s *Scheduler) addTask(time string, task ISchedulerTask) (int, error) {
+	schedule, err := ParseSpec(time, s.location)
 	if err != nil {
 		return 0, err
 	}
+	return s.addSchedule(time, schedule, false, task)
+}
+
+/*
+spec: 僅用於ListTasks顯示
+once: 執行一次後自動移除
+*/
+func (s *Scheduler) addSchedule(spec string, schedule cron.Schedule, once bool, task ISchedulerTask) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := s.newSchedulerJob(spec, task)
+	job.schedule = schedule
+	job.once = once
+	entityId := s.cron.Schedule(schedule, job)
+	job.id.Store(int64(entityId))
+	s.jobs[int(entityId)] = job
 
 	return int(entityId), nil
 }
@@ -100,6 +264,7 @@ func (s *Scheduler) removeTask(taskId int) error {
 	defer s.mu.Unlock()
 
 	s.cron.Remove(cron.EntryID(taskId))
+	delete(s.jobs, taskId)
 
 	return nil
 }
@@ -112,23 +277,36 @@ func (s *Scheduler) RemoveTask(taskId int) error {
 	return s.removeTask(taskId)
 }
 
-// 先移除，再新增
+// 先檢查排程格式，再移除後新增
 func (s *Scheduler) UpdateTask(taskId int, time string, task ISchedulerTask) (int, error) {
-	err := s.removeTask(taskId)
+	schedule, err := ParseSpec(time, s.location)
+	if err != nil {
+		return 0, err
+	}
+	err = s.removeTask(taskId)
 	if err != nil {
 		return 0, err
 	}
 
-	return s.addTask(time, task)
+	return s.addSchedule(time, schedule, false, task)
 }
 
 /*
 used go routine inside
+啟動時依補執行策略處理停止期間錯過的觸發
 */
 func (s *Scheduler) Start() {
+	now := time.Now()
 	go s.cron.Start()
+	s.catchUpMisfires(now)
 }
 
+// 停止排程並取消執行中任務的ctx
 func (s *Scheduler) Stop() {
 	s.cron.Stop()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		job.cancelRuns()
+	}
 }
@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+var ErrInvalidSpec = errors.New("invalid schedule spec")
+
+/*
+排程格式，秒欄位可省略
+
+	[CRON_TZ=時區 ]秒 分 時 日 月 週
+	[CRON_TZ=時區 ]分 時 日 月 週
+	[CRON_TZ=時區 ]@every 1h30m
+	[CRON_TZ=時區 ]@daily、@hourly等cron描述
+*/
+var specParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+var specFields = []struct {
+	name   string
+	option cron.ParseOption
+}{
+	{"second", cron.Second},
+	{"minute", cron.Minute},
+	{"hour", cron.Hour},
+	{"day of month", cron.Dom},
+	{"month", cron.Month},
+	{"day of week", cron.Dow},
+}
+
+// 檢查排程格式，錯誤訊息指出有問題的部分
+func ValidateSpec(spec string) error {
+	_, err := ParseSpec(spec, time.Local)
+	return err
+}
+
+/*
+解析排程
+
+	loc: spec沒有CRON_TZ或TZ前綴時使用的時區，nil表示time.Local
+*/
+func ParseSpec(spec string, loc *time.Location) (cron.Schedule, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("%w: empty spec", ErrInvalidSpec)
+	}
+
+	if strings.HasPrefix(spec, "TZ=") || strings.HasPrefix(spec, "CRON_TZ=") {
+		tz, rest, _ := strings.Cut(spec, " ")
+		name := tz[strings.Index(tz, "=")+1:]
+		var err error
+		if loc, err = time.LoadLocation(name); err != nil || name == "" {
+			return nil, fmt.Errorf("%w: time zone %q: unknown time zone", ErrInvalidSpec, name)
+		}
+		spec = strings.TrimSpace(rest)
+		if spec == "" {
+			return nil, fmt.Errorf("%w: missing schedule after time zone %q", ErrInvalidSpec, name)
+		}
+	}
+
+	if strings.HasPrefix(spec, "@every") {
+		interval := strings.TrimSpace(strings.TrimPrefix(spec, "@every"))
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, fmt.Errorf("%w: @every interval %q: %v", ErrInvalidSpec, interval, err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("%w: @every interval %q must be at least 1s", ErrInvalidSpec, interval)
+		}
+		return cron.Every(d), nil
+	}
+
+	if strings.HasPrefix(spec, "@") {
+		schedule, err := specParser.Parse(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unrecognized descriptor %q", ErrInvalidSpec, spec)
+		}
+		schedule.(*cron.SpecSchedule).Location = loc
+		return schedule, nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 && len(fields) != 6 {
+		return nil, fmt.Errorf("%w: expected 5 or 6 fields (second is optional), got %d", ErrInvalidSpec, len(fields))
+	}
+	names := specFields[len(specFields)-len(fields):]
+	for i, field := range fields {
+		if _, err := cron.NewParser(names[i].option).Parse(field); err != nil {
+			return nil, fmt.Errorf("%w: %s field %q: %v", ErrInvalidSpec, names[i].name, field, err)
+		}
+	}
+	schedule, err := specParser.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSpec, err)
+	}
+	schedule.(*cron.SpecSchedule).Location = loc
+	return schedule, nil
+}
+
+// 只在at觸發一次的排程
+type onceSchedule struct {
+	at time.Time
+}
+
+/*
+at之後回傳零值，cron不再觸發
+scheduler啟動時at已過由catchUpOnce依補執行策略處理
+*/
+func (o onceSchedule) Next(t time.Time) time.Time {
+	if t.Before(o.at) {
+		return o.at
+	}
+	return time.Time{}
+}
+
+// 設定scheduler預設時區，預設為time.Local
+func WithLocation(loc *time.Location) SchedulerOption {
+	return func(s *Scheduler) {
+		if loc != nil {
+			s.location = loc
+		}
+	}
+}
+
+/*
+在at執行一次，執行完畢後自動移除
+at需晚於現在時間，scheduler啟動時at已過則依補執行策略補執行一次，未設定策略時略過並移除
+*/
+func (s *Scheduler) RunAt(at time.Time, task ISchedulerTask) (int, error) {
+	if !at.After(time.Now()) {
+		return 0, fmt.Errorf("%w: run time %s is not in the future", ErrInvalidSpec, at.Format(time.RFC3339))
+	}
+	return s.addSchedule("@at "+at.Format(time.RFC3339), onceSchedule{at: at}, true, task)
+}
+
+// 每隔interval執行，interval需至少1秒，以秒為單位
+func (s *Scheduler) RunEvery(interval time.Duration, task ISchedulerTask) (int, error) {
+	if interval < time.Second {
+		return 0, fmt.Errorf("%w: interval %s must be at least 1s", ErrInvalidSpec, interval)
+	}
+	return s.addSchedule("@every "+interval.String(), cron.Every(interval), false, task)
+}
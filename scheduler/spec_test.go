@@ -0,0 +1,99 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSpec(t *testing.T) {
+	taipei, err := time.LoadLocation("Asia/Taipei")
+	require.NoError(t, err)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	//秒欄位可省略
+	schedule, err := ParseSpec("*/10 * * * * *", time.UTC)
+	require.NoError(t, err)
+	require.Equal(t, base.Add(10*time.Second), schedule.Next(base))
+	schedule, err = ParseSpec("30 9 * * *", time.UTC)
+	require.NoError(t, err)
+	require.Equal(t, base.Add(9*time.Hour+30*time.Minute), schedule.Next(base))
+
+	//前綴時區優先於預設時區
+	schedule, err = ParseSpec("CRON_TZ=Asia/Taipei 0 9 * * *", time.UTC)
+	require.NoError(t, err)
+	require.True(t, time.Date(2024, 1, 1, 9, 0, 0, 0, taipei).Equal(schedule.Next(base)))
+	schedule, err = ParseSpec("@daily", taipei)
+	require.NoError(t, err)
+	require.True(t, time.Date(2024, 1, 2, 0, 0, 0, 0, taipei).Equal(schedule.Next(base)))
+
+	schedule, err = ParseSpec("@every 90s", nil)
+	require.NoError(t, err)
+	require.Equal(t, cron.Every(90*time.Second), schedule)
+
+	cases := map[string]string{
+		"":                            "empty spec",
+		"CRON_TZ=Mars/Base * * * * *": `time zone "Mars/Base"`,
+		"TZ=UTC":                      "missing schedule",
+		"@every soon":                 `@every interval "soon"`,
+		"@every 10ms":                 "at least 1s",
+		"@sometimes":                  "unrecognized descriptor",
+		"* * *":                       "expected 5 or 6 fields",
+		"0 61 * * * *":                `minute field "61"`,
+		"61 * * * *":                  `minute field "61"`,
+		"* 25 * * *":                  `hour field "25"`,
+		"* * 0 * *":                   `day of month field "0"`,
+		"* * * FOO *":                 `month field "FOO"`,
+		"* * * * 1-9":                 `day of week field "1-9"`,
+		"70 * * * * *":                `second field "70"`,
+	}
+	for spec, msg := range cases {
+		err := ValidateSpec(spec)
+		require.ErrorIs(t, err, ErrInvalidSpec, spec)
+		require.Contains(t, err.Error(), msg, spec)
+	}
+}
+
+func TestSchedulerRunAtAndRunEvery(t *testing.T) {
+	s := NewScheduler(WithLocation(time.UTC))
+	_, err := s.AddTask("0 61 * * *", &countSchedulerTask{})
+	require.ErrorIs(t, err, ErrInvalidSpec)
+	_, err = s.RunAt(time.Now().Add(-time.Second), &countSchedulerTask{})
+	require.ErrorIs(t, err, ErrInvalidSpec)
+	_, err = s.RunEvery(time.Millisecond, &countSchedulerTask{})
+	require.ErrorIs(t, err, ErrInvalidSpec)
+
+	//更新為錯誤格式時保留原任務
+	id, err := s.AddTask("@hourly", &countSchedulerTask{})
+	require.NoError(t, err)
+	_, err = s.UpdateTask(id, "* * * * * * *", &countSchedulerTask{})
+	require.ErrorIs(t, err, ErrInvalidSpec)
+	_, err = s.GetTask(id)
+	require.NoError(t, err)
+
+	once := &countSchedulerTask{}
+	onceId, err := s.RunAt(time.Now().Add(200*time.Millisecond), once)
+	require.NoError(t, err)
+	every := &countSchedulerTask{}
+	everyId, err := s.RunEvery(time.Second, every)
+	require.NoError(t, err)
+	info, err := s.GetTask(everyId)
+	require.NoError(t, err)
+	require.Equal(t, "@every 1s", info.Spec)
+
+	s.Start()
+	defer s.Stop()
+
+	//執行一次後移除
+	require.Eventually(t, func() bool {
+		_, err := s.GetTask(onceId)
+		return err != nil
+	}, 3*time.Second, 10*time.Millisecond)
+	require.EqualValues(t, 1, once.GetStatus().RunCount.Load())
+
+	require.Eventually(t, func() bool {
+		return every.GetStatus().RunCount.Load() >= 2
+	}, 4*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,215 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/RoyceAzure/rj/infra/mail"
+	"github.com/RoyceAzure/rj/util/backoff"
+)
+
+/*
+回傳error的排程任務，以AddTaskV2加入
+回傳error或panic時視為失敗，依重試策略在同一次觸發內重試
+*/
+type ISchedulerTaskV2 interface {
+	Run(ctx context.Context) error
+	GetStatus() *SchedulerTaskStatus
+	SetStatus(*SchedulerTaskStatus)
+}
+
+// 將ISchedulerTaskV2轉為ISchedulerTask，讓cron與既有流程共用
+type schedulerTaskV2Adapter struct {
+	ISchedulerTaskV2
+}
+
+func (a *schedulerTaskV2Adapter) RunSchedulerTask() {
+	a.Run(context.Background())
+}
+
+// 回傳使用者加入的任務，用於檢查任務實作的可選介面
+func originTask(task ISchedulerTask) any {
+	if a, ok := task.(*schedulerTaskV2Adapter); ok {
+		return a.ISchedulerTaskV2
+	}
+	return task
+}
+
+/*
+排程任務重試策略
+
+	MaxAttempts: 包含第一次執行的總次數，<=1 表示不重試
+	InitialBackoff: 第一次重試前的等待時間
+	MaxBackoff: 等待時間上限，0表示不限制
+	Multiplier: 每次重試等待時間的倍數，<=1 視為2
+	Jitter: 等待時間隨機浮動比例(0~1)，避免多個任務同時重試
+*/
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64
+}
+
+// 第attempt次執行失敗後，重試前的等待時間
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	return backoff.Exponential(p.InitialBackoff, p.MaxBackoff, p.Multiplier, p.Jitter, attempt)
+}
+
+// 任務可選擇實作RetryableSchedulerTask，覆寫scheduler預設的重試策略
+type RetryableSchedulerTask interface {
+	GetRetryPolicy() *RetryPolicy
+}
+
+// 設定預設重試策略，預設不重試
+func WithRetryPolicy(policy *RetryPolicy) SchedulerOption {
+	return func(s *Scheduler) {
+		s.retryPolicy = policy
+	}
+}
+
+// 連續失敗通知內容
+type FailureEvent struct {
+	TaskId              int
+	TaskName            string
+	ConsecutiveFailures int64
+	Err                 error
+	Time                time.Time
+}
+
+// 任務連續失敗達到門檻時呼叫
+type FailureNotifier interface {
+	NotifyFailure(ctx context.Context, event FailureEvent) error
+}
+
+// 將func轉為FailureNotifier
+type FailureNotifierFunc func(ctx context.Context, event FailureEvent) error
+
+func (f FailureNotifierFunc) NotifyFailure(ctx context.Context, event FailureEvent) error {
+	return f(ctx, event)
+}
+
+/*
+設定失敗通知，任務連續失敗次數達到threshold時通知一次，成功後重新計算
+
+	threshold: <=0 視為1
+*/
+func WithFailureNotifier(notifier FailureNotifier, threshold int) SchedulerOption {
+	return func(s *Scheduler) {
+		if threshold <= 0 {
+			threshold = 1
+		}
+		s.notifier = notifier
+		s.notifyThreshold = int64(threshold)
+	}
+}
+
+// 以EmailSender寄送失敗通知
+type EmailFailureNotifier struct {
+	sender        mail.EmailSender
+	to            []string
+	SubjectPrefix string
+}
+
+func NewEmailFailureNotifier(sender mail.EmailSender, to ...string) *EmailFailureNotifier {
+	return &EmailFailureNotifier{
+		sender:        sender,
+		to:            to,
+		SubjectPrefix: "[scheduler]",
+	}
+}
+
+func (n *EmailFailureNotifier) NotifyFailure(ctx context.Context, event FailureEvent) error {
+	subject := fmt.Sprintf("%s task %s failed %d times", n.SubjectPrefix, event.TaskName, event.ConsecutiveFailures)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<p>task id: %d</p>", event.TaskId)
+	fmt.Fprintf(&sb, "<p>task name: %s</p>", html.EscapeString(event.TaskName))
+	fmt.Fprintf(&sb, "<p>consecutive failures: %d</p>", event.ConsecutiveFailures)
+	fmt.Fprintf(&sb, "<p>time: %s</p>", event.Time.Format(time.RFC3339))
+	if event.Err != nil {
+		fmt.Fprintf(&sb, "<p>error: %s</p>", html.EscapeString(event.Err.Error()))
+	}
+	return n.sender.SendEmail(subject, sb.String(), n.to, nil, nil, nil)
+}
+
+var (
+	_ FailureNotifier = FailureNotifierFunc(nil)
+	_ FailureNotifier = (*EmailFailureNotifier)(nil)
+)
+
+/*
+依重試策略執行任務，直到成功、達到次數上限或ctx結束
+
+	return:
+		attempts: 執行次數
+		err: 最後一次執行的錯誤
+*/
+func (s *Scheduler) execute(ctx context.Context, task ISchedulerTask) (attempts int, err error) {
+	policy := s.retryPolicy
+	if t, ok := originTask(task).(RetryableSchedulerTask); ok {
+		if p := t.GetRetryPolicy(); p != nil {
+			policy = p
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = runOnce(ctx, task)
+		if err == nil || policy == nil || attempt >= policy.MaxAttempts || ctx.Err() != nil {
+			return attempt, err
+		}
+
+		timer := time.NewTimer(policy.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		case <-timer.C:
+		}
+	}
+}
+
+// 執行一次任務，panic轉為error
+func runOnce(ctx context.Context, task ISchedulerTask) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic in task: %v", r)
+		}
+	}()
+	switch t := originTask(task).(type) {
+	case ISchedulerTaskV2:
+		return t.Run(ctx)
+	case IContextSchedulerTask:
+		t.RunWithContext(ctx)
+		return nil
+	}
+	task.RunSchedulerTask()
+	return nil
+}
+
+// 更新連續失敗次數，達到門檻時通知
+func (s *Scheduler) taskFailed(taskId int, task ISchedulerTask, err error) {
+	failures := task.GetStatus().ConsecutiveFailures.Add(1)
+	if s.notifier == nil || failures != s.notifyThreshold {
+		return
+	}
+	event := FailureEvent{
+		TaskId:              taskId,
+		TaskName:            taskNameOf(taskId, task),
+		ConsecutiveFailures: failures,
+		Err:                 err,
+		Time:                time.Now().UTC(),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if nerr := s.notifier.NotifyFailure(ctx, event); nerr != nil {
+		fmt.Printf("notify scheduler task %d failure failed, err : %v\n", taskId, nerr)
+	}
+}
+
+func (s *Scheduler) AddTaskV2(time string, task ISchedulerTaskV2) (int, error) {
+	return s.addTask(time, &schedulerTaskV2Adapter{task})
+}
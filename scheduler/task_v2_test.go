@@ -0,0 +1,102 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type flakySchedulerTask struct {
+	BaseSchedulerTask
+	failTimes int
+	calls     int
+}
+
+func (t *flakySchedulerTask) Run(ctx context.Context) error {
+	t.calls++
+	if t.calls <= t.failTimes {
+		return errors.New("temporary")
+	}
+	return nil
+}
+
+func (t *flakySchedulerTask) GetTaskName() string { return "flaky" }
+
+func TestSchedulerTaskV2RetryAndNotify(t *testing.T) {
+	var events []FailureEvent
+	history := NewMemoryRunHistoryStore(0)
+	s := NewScheduler(
+		WithRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}),
+		WithFailureNotifier(FailureNotifierFunc(func(ctx context.Context, event FailureEvent) error {
+			events = append(events, event)
+			return nil
+		}), 2),
+		WithRunHistory(history),
+	)
+
+	//第三次成功
+	task := &flakySchedulerTask{failTimes: 2}
+	wrapped := &schedulerTaskV2Adapter{task}
+	s.runTask(context.Background(), 1, wrapped, TriggerCron)
+	require.Equal(t, 3, task.calls)
+	require.Nil(t, task.GetStatus().GetLastError())
+
+	//每次觸發都失敗，連續失敗兩次時通知一次
+	task.calls, task.failTimes = 0, 100
+	for i := 0; i < 3; i++ {
+		s.runTask(context.Background(), 1, wrapped, TriggerCron)
+	}
+	require.Equal(t, 9, task.calls)
+	require.EqualValues(t, 3, task.GetStatus().ConsecutiveFailures.Load())
+	require.EqualError(t, task.GetStatus().GetLastError(), "temporary")
+	require.Len(t, events, 1)
+	require.Equal(t, "flaky", events[0].TaskName)
+	require.EqualValues(t, 2, events[0].ConsecutiveFailures)
+
+	runs, err := history.ListRuns(context.Background(), "flaky", 1)
+	require.NoError(t, err)
+	require.Equal(t, RunFailed, runs[0].Outcome)
+	require.Equal(t, 3, runs[0].Attempts)
+
+	task.failTimes = 0
+	s.runTask(context.Background(), 1, wrapped, TriggerCron)
+	require.Zero(t, task.GetStatus().ConsecutiveFailures.Load())
+}
+
+func TestRetryPolicyBackoffJitter(t *testing.T) {
+	p := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		d := p.Backoff(1)
+		require.GreaterOrEqual(t, d, 50*time.Millisecond)
+		require.LessOrEqual(t, d, 150*time.Millisecond)
+		require.LessOrEqual(t, p.Backoff(5), 300*time.Millisecond)
+	}
+	require.Equal(t, 200*time.Millisecond, (&RetryPolicy{InitialBackoff: 100 * time.Millisecond}).Backoff(2))
+}
+
+type captureEmailSender struct {
+	subject string
+	content string
+}
+
+func (s *captureEmailSender) SendEmail(subject, content string, to, cc, bcc, attachFiles []string) error {
+	s.subject, s.content = subject, content
+	return nil
+}
+
+func TestEmailFailureNotifierEscapesHTML(t *testing.T) {
+	sender := &captureEmailSender{}
+	n := NewEmailFailureNotifier(sender, "ops@example.com")
+	require.NoError(t, n.NotifyFailure(context.Background(), FailureEvent{
+		TaskName: "<b>report</b>",
+		Err:      errors.New(`query "a<b" failed & retried`),
+		Time:     time.Now(),
+	}))
+	require.NotContains(t, sender.content, "<b>")
+	require.Contains(t, sender.content, "&lt;b&gt;report&lt;/b&gt;")
+	require.Contains(t, sender.content, "a&lt;b")
+	require.Contains(t, sender.content, "&amp; retried")
+}
@@ -0,0 +1,41 @@
+package backoff
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+/*
+指數退避，計算第attempt次執行失敗後，重試前的等待時間
+
+	initial: 第一次重試前的等待時間
+	max: 等待時間上限，0表示不限制
+	multiplier: 每次重試等待時間的倍數，<=1 視為2
+	jitter: 等待時間隨機浮動比例(0~1)，超過1視為1
+	attempt: 已執行次數，從1開始
+*/
+func Exponential(initial, max time.Duration, multiplier, jitter float64, attempt int) time.Duration {
+	if multiplier <= 1 {
+		multiplier = 2
+	}
+
+	backoff := float64(initial)
+	for i := 1; i < attempt; i++ {
+		backoff *= multiplier
+		if max > 0 && backoff >= float64(max) {
+			backoff = float64(max)
+			break
+		}
+	}
+
+	if jitter > 0 {
+		if jitter > 1 {
+			jitter = 1
+		}
+		backoff += backoff * jitter * (rand.Float64()*2 - 1)
+	}
+	if max > 0 && backoff > float64(max) {
+		backoff = float64(max)
+	}
+	return time.Duration(backoff)
+}
@@ -0,0 +1,27 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExponential(t *testing.T) {
+	require.Equal(t, 10*time.Millisecond, Exponential(10*time.Millisecond, 50*time.Millisecond, 2, 0, 1))
+	require.Equal(t, 20*time.Millisecond, Exponential(10*time.Millisecond, 50*time.Millisecond, 2, 0, 2))
+	require.Equal(t, 40*time.Millisecond, Exponential(10*time.Millisecond, 50*time.Millisecond, 2, 0, 3))
+	require.Equal(t, 50*time.Millisecond, Exponential(10*time.Millisecond, 50*time.Millisecond, 2, 0, 4))
+	//multiplier<=1視為2，max為0不限制
+	require.Equal(t, 80*time.Millisecond, Exponential(10*time.Millisecond, 0, 1, 0, 4))
+
+	for i := 0; i < 20; i++ {
+		d := Exponential(10*time.Millisecond, 0, 2, 0.5, 1)
+		require.GreaterOrEqual(t, d, 5*time.Millisecond)
+		require.LessOrEqual(t, d, 15*time.Millisecond)
+	}
+	//jitter不超過max
+	for i := 0; i < 20; i++ {
+		require.LessOrEqual(t, Exponential(40*time.Millisecond, 50*time.Millisecond, 2, 1, 2), 50*time.Millisecond)
+	}
+}
@@ -0,0 +1,224 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Prometheus text exposition format 0.0.4
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+func L(name, value string) Label {
+	return Label{Name: name, Value: value}
+}
+
+// 由各模組實作，將自身狀態寫入Writer
+type Collector interface {
+	Collect(w *Writer)
+}
+
+// 將func轉為Collector
+type CollectorFunc func(w *Writer)
+
+func (f CollectorFunc) Collect(w *Writer) {
+	f(w)
+}
+
+/*
+以Prometheus text format寫出指標
+同一個指標名稱的樣本需連續寫入，HELP與TYPE只會在第一次寫入時輸出
+*/
+type Writer struct {
+	w        *bufio.Writer
+	declared map[string]bool
+	err      error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w:        bufio.NewWriter(w),
+		declared: make(map[string]bool),
+	}
+}
+
+func (w *Writer) Gauge(name, help string, value float64, labels ...Label) {
+	w.declare(name, help, "gauge")
+	w.sample(name, labels, value)
+}
+
+func (w *Writer) Counter(name, help string, value float64, labels ...Label) {
+	w.declare(name, help, "counter")
+	w.sample(name, labels, value)
+}
+
+// 寫出histogram的_bucket、_sum、_count樣本
+func (w *Writer) Histogram(name, help string, snapshot HistogramSnapshot, labels ...Label) {
+	w.declare(name, help, "histogram")
+	var cumulative uint64
+	for i, upper := range snapshot.Buckets {
+		cumulative += snapshot.Counts[i]
+		w.sample(name+"_bucket", append(labels[:len(labels):len(labels)], L("le", formatFloat(upper))), float64(cumulative))
+	}
+	w.sample(name+"_bucket", append(labels[:len(labels):len(labels)], L("le", "+Inf")), float64(snapshot.Count))
+	w.sample(name+"_sum", labels, snapshot.Sum)
+	w.sample(name+"_count", labels, float64(snapshot.Count))
+}
+
+// 寫入過程中第一個發生的錯誤
+func (w *Writer) Err() error {
+	return w.err
+}
+
+func (w *Writer) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+func (w *Writer) declare(name, help, typ string) {
+	if w.declared[name] {
+		return
+	}
+	w.declared[name] = true
+	if help != "" {
+		w.printf("# HELP %s %s\n", name, escapeHelp(help))
+	}
+	w.printf("# TYPE %s %s\n", name, typ)
+}
+
+func (w *Writer) sample(name string, labels []Label, value float64) {
+	if len(labels) == 0 {
+		w.printf("%s %s\n", name, formatFloat(value))
+		return
+	}
+	var sb strings.Builder
+	for i, l := range labels {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(l.Name)
+		sb.WriteString(`="`)
+		sb.WriteString(escapeLabel(l.Value))
+		sb.WriteByte('"')
+	}
+	w.printf("%s{%s} %s\n", name, sb.String(), formatFloat(value))
+}
+
+func (w *Writer) printf(format string, args ...any) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = fmt.Fprintf(w.w, format, args...)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(v string) string {
+	return labelReplacer.Replace(v)
+}
+
+func escapeHelp(v string) string {
+	return helpReplacer.Replace(v)
+}
+
+// 預設histogram上界(秒)
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// 執行緒安全的histogram
+type Histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+	mu      sync.Mutex
+}
+
+// buckets: 各bucket上界，nil時使用DefaultBuckets
+func NewHistogram(buckets []float64) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	b := make([]float64, len(buckets))
+	copy(b, buckets)
+	sort.Float64s(b)
+	return &Histogram{
+		buckets: b,
+		counts:  make([]uint64, len(b)),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	idx := sort.SearchFloat64s(h.buckets, v)
+	if idx < len(h.buckets) {
+		h.counts[idx]++
+	}
+	h.sum += v
+	h.count++
+}
+
+/*
+histogram某一時間點的數據
+
+	Counts: 落在各bucket(非累計)的數量，與Buckets對應
+*/
+type HistogramSnapshot struct {
+	Buckets []float64
+	Counts  []uint64
+	Sum     float64
+	Count   uint64
+}
+
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	counts := make([]uint64, len(h.counts))
+	copy(counts, h.counts)
+	return HistogramSnapshot{
+		Buckets: h.buckets,
+		Counts:  counts,
+		Sum:     h.sum,
+		Count:   h.count,
+	}
+}
+
+// 回傳以Prometheus text format輸出collectors指標的http.Handler
+func Handler(collectors ...Collector) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", ContentType)
+		w := NewWriter(rw)
+		for _, c := range collectors {
+			c.Collect(w)
+		}
+		w.Flush()
+	})
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerTextFormat(t *testing.T) {
+	h := NewHistogram([]float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(3)
+
+	handler := Handler(CollectorFunc(func(w *Writer) {
+		w.Gauge("queue_depth", "Queue depth.", 3, L("lane", "bulk"))
+		w.Gauge("queue_depth", "Queue depth.", 1, L("lane", `a"b`))
+		w.Counter("runs_total", "", 2)
+		w.Histogram("duration_seconds", "Duration.", h.Snapshot(), L("task", "x"))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, ContentType, rec.Header().Get("Content-Type"))
+	require.Equal(t, `# HELP queue_depth Queue depth.
+# TYPE queue_depth gauge
+queue_depth{lane="bulk"} 3
+queue_depth{lane="a\"b"} 1
+# TYPE runs_total counter
+runs_total 2
+# HELP duration_seconds Duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{task="x",le="0.1"} 1
+duration_seconds_bucket{task="x",le="1"} 2
+duration_seconds_bucket{task="x",le="+Inf"} 3
+duration_seconds_sum{task="x"} 3.55
+duration_seconds_count{task="x"} 3
+`, rec.Body.String())
+}
@@ -0,0 +1,277 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RoyceAzure/rj/api"
+)
+
+var ErrIntakePaused = errors.New("sync task system intake is paused")
+
+const defaultFailureHistorySize = 100
+
+// 執行失敗的任務紀錄
+type FailedTask struct {
+	TaskId   string         `json:"task_id"`
+	TaskName string         `json:"task_name"`
+	Code     TaskResultCode `json:"code"`
+	Error    string         `json:"error"`
+	Attempts int            `json:"attempts"`
+	FailedAt time.Time      `json:"failed_at"`
+}
+
+// 保存最近size筆失敗任務的環狀緩衝
+type failureHistory struct {
+	items []FailedTask
+	next  int
+	full  bool
+	mu    sync.Mutex
+}
+
+func newFailureHistory(size int) *failureHistory {
+	if size <= 0 {
+		size = defaultFailureHistorySize
+	}
+	return &failureHistory{items: make([]FailedTask, size)}
+}
+
+func (h *failureHistory) add(item FailedTask) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.items[h.next] = item
+	h.next = (h.next + 1) % len(h.items)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// 由新到舊回傳紀錄
+func (h *failureHistory) list() []FailedTask {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := h.next
+	if h.full {
+		n = len(h.items)
+	}
+	res := make([]FailedTask, 0, n)
+	for i := 1; i <= n; i++ {
+		res = append(res, h.items[(h.next-i+len(h.items))%len(h.items)])
+	}
+	return res
+}
+
+// 設定保存最近失敗任務的筆數，預設100
+func WithFailureHistory(size int) SystemOption {
+	return func(cfg *systemConfig) {
+		cfg.failureHistory = size
+	}
+}
+
+func (t *systemTask) recordFailure(res *TaskResult) {
+	item := FailedTask{
+		TaskId:   res.TaskId,
+		TaskName: res.TaskName,
+		Code:     res.Code,
+		Attempts: len(t.attempts),
+		FailedAt: time.Now().UTC(),
+	}
+	if res.Error != nil {
+		item.Error = res.Error.Error()
+	}
+	t.system.failures.add(item)
+}
+
+// 最近執行失敗的任務，由新到舊
+func (s *SyncTaskSystem) RecentFailures() []FailedTask {
+	return s.failures.list()
+}
+
+// 暫停接收任務，暫停期間送入的任務以ErrIntakePaused完成，已接收的任務照常執行
+func (s *SyncTaskSystem) PauseIntake() {
+	s.paused.Store(true)
+}
+
+func (s *SyncTaskSystem) ResumeIntake() {
+	s.paused.Store(false)
+}
+
+func (s *SyncTaskSystem) IntakePaused() bool {
+	return s.paused.Load()
+}
+
+/*
+暫停接收任務並等待已接收任務全部執行完畢，完成後維持暫停狀態
+ctx結束時回傳ctx.Err()，未完成的任務繼續執行
+*/
+func (s *SyncTaskSystem) Drain(ctx context.Context) error {
+	s.PauseIntake()
+	return s.waitIdle(ctx)
+}
+
+/*
+系統管理用http.Handler，回應格式為api.Response
+
+	GET    /workers          worker列表與統計
+	POST   /workers?count=n  由pool取出n個worker加入系統，預設1
+	DELETE /workers/{id}     移除worker，執行完已接收的任務後放回pool，AutoScaler管理的worker回傳409
+	GET    /stats            系統統計
+	GET    /queues           各通道狀態
+	GET    /failures         最近失敗任務
+	POST   /intake/pause     暫停接收任務
+	POST   /intake/resume    恢復接收任務
+	POST   /drain?timeout=30s 暫停接收並等待任務執行完畢
+
+	pool: 可為nil，此時無法新增worker，移除的worker不放回pool
+*/
+func NewAdminHandler(s *SyncTaskSystem, pool *WorkerPool) http.Handler {
+	a := &adminHandler{system: s, pool: pool}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /workers", a.listWorkers)
+	mux.HandleFunc("POST /workers", a.addWorkers)
+	mux.HandleFunc("DELETE /workers/{id}", a.removeWorker)
+	mux.HandleFunc("GET /stats", a.stats)
+	mux.HandleFunc("GET /queues", a.queues)
+	mux.HandleFunc("GET /failures", a.failures)
+	mux.HandleFunc("POST /intake/pause", a.pauseIntake)
+	mux.HandleFunc("POST /intake/resume", a.resumeIntake)
+	mux.HandleFunc("POST /drain", a.drain)
+	return mux
+}
+
+type adminHandler struct {
+	system *SyncTaskSystem
+	pool   *WorkerPool
+}
+
+type WorkerView struct {
+	Id      string            `json:"id"`
+	Statics WorkerStaticsData `json:"statics"`
+}
+
+type SystemView struct {
+	SystemStaticsData
+	Outstanding  int    `json:"outstanding"`
+	Finished     uint64 `json:"finished"`
+	IntakePaused bool   `json:"intake_paused"`
+}
+
+type DrainView struct {
+	Drained     bool `json:"drained"`
+	Outstanding int  `json:"outstanding"`
+}
+
+func (a *adminHandler) workerViews() []WorkerView {
+	workers := a.system.GetWorkers()
+	res := make([]WorkerView, len(workers))
+	for i, w := range workers {
+		res[i] = WorkerView{Id: workerId(w, i), Statics: w.GetStatusData()}
+	}
+	return res
+}
+
+func (a *adminHandler) listWorkers(w http.ResponseWriter, r *http.Request) {
+	api.SuccessJSON(w, a.workerViews(), nil)
+}
+
+func (a *adminHandler) addWorkers(w http.ResponseWriter, r *http.Request) {
+	if a.pool == nil {
+		api.ErrorJSON(w, http.StatusBadRequest, nil, "worker pool not configured")
+		return
+	}
+	count := 1
+	if v := r.URL.Query().Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			api.ErrorJSON(w, http.StatusBadRequest, err, "invalid count")
+			return
+		}
+		count = n
+	}
+	for i := 0; i < count; i++ {
+		a.system.AddWorker(a.pool.Get())
+	}
+	api.SuccessJSON(w, a.workerViews(), nil)
+}
+
+func (a *adminHandler) removeWorker(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	for i, wk := range a.system.GetWorkers() {
+		if workerId(wk, i) != id {
+			continue
+		}
+		//由AutoScaler回收，避免同一個worker被放回pool兩次
+		if a.system.autoScaled(wk) {
+			api.ErrorJSON(w, http.StatusConflict, nil, fmt.Sprintf("worker %s is managed by autoscaler", id))
+			return
+		}
+		if !a.system.RemoveWorker(wk) {
+			break
+		}
+		if worker, ok := wk.(*Worker); ok && a.pool != nil && worker.Done() != nil {
+			go func() {
+				<-worker.Done()
+				a.pool.Put(worker)
+			}()
+		}
+		api.SuccessJSON(w, a.workerViews(), nil)
+		return
+	}
+	api.ErrorJSON(w, http.StatusNotFound, nil, fmt.Sprintf("worker %s not found", id))
+}
+
+func (a *adminHandler) systemView() SystemView {
+	return SystemView{
+		SystemStaticsData: a.system.GetStatusData(),
+		Outstanding:       a.system.outstanding(),
+		Finished:          a.system.finished.Load(),
+		IntakePaused:      a.system.IntakePaused(),
+	}
+}
+
+func (a *adminHandler) stats(w http.ResponseWriter, r *http.Request) {
+	api.SuccessJSON(w, a.systemView(), nil)
+}
+
+func (a *adminHandler) queues(w http.ResponseWriter, r *http.Request) {
+	api.SuccessJSON(w, a.system.lanes.statics(), nil)
+}
+
+func (a *adminHandler) failures(w http.ResponseWriter, r *http.Request) {
+	api.SuccessJSON(w, a.system.RecentFailures(), nil)
+}
+
+func (a *adminHandler) pauseIntake(w http.ResponseWriter, r *http.Request) {
+	a.system.PauseIntake()
+	api.SuccessJSON(w, a.systemView(), nil)
+}
+
+func (a *adminHandler) resumeIntake(w http.ResponseWriter, r *http.Request) {
+	a.system.ResumeIntake()
+	api.SuccessJSON(w, a.systemView(), nil)
+}
+
+func (a *adminHandler) drain(w http.ResponseWriter, r *http.Request) {
+	timeout := 30 * time.Second
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			api.ErrorJSON(w, http.StatusBadRequest, err, "invalid timeout")
+			return
+		}
+		timeout = d
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	err := a.system.Drain(ctx)
+	api.SuccessJSON(w, DrainView{
+		Drained:     err == nil,
+		Outstanding: a.system.outstanding(),
+	}, nil)
+}
@@ -0,0 +1,97 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func adminRequest(t *testing.T, h http.Handler, method, target string, data any) int {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	if rec.Code == http.StatusOK && data != nil {
+		var body struct {
+			Success bool            `json:"success"`
+			Data    json.RawMessage `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		require.True(t, body.Success)
+		require.NoError(t, json.Unmarshal(body.Data, data))
+	}
+	return rec.Code
+}
+
+func TestAdminHandler(t *testing.T) {
+	s, cancel := NewSyncTaskSystem(10, WithFailureHistory(2))
+	defer cancel()
+	s.Start()
+	h := NewAdminHandler(s, NewWorkerPool())
+
+	var workers []WorkerView
+	require.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodPost, "/workers?count=2", &workers))
+	require.Len(t, workers, 2)
+
+	ctx, cancelWait := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelWait()
+	for _, handle := range s.TaskInQueue(&valueTask{err: errors.New("a")}, &valueTask{err: errors.New("b")}, &valueTask{err: errors.New("c")}) {
+		_, err := handle.Wait(ctx)
+		require.NoError(t, err)
+	}
+	var failures []FailedTask
+	require.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodGet, "/failures", &failures))
+	require.Len(t, failures, 2)
+
+	var stats SystemView
+	require.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodPost, "/intake/pause", &stats))
+	require.True(t, stats.IntakePaused)
+	res := s.TaskInQueue(&valueTask{})[0].Result()
+	require.ErrorIs(t, res.Error, ErrIntakePaused)
+
+	var drain DrainView
+	require.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodPost, "/drain?timeout=1s", &drain))
+	require.True(t, drain.Drained)
+	require.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodPost, "/intake/resume", &stats))
+	require.False(t, stats.IntakePaused)
+	require.EqualValues(t, 3, stats.Finished)
+
+	require.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodDelete, "/workers/"+workers[0].Id, &workers))
+	require.Len(t, workers, 1)
+	require.Equal(t, http.StatusNotFound, adminRequest(t, h, http.MethodDelete, "/workers/unknown", nil))
+}
+
+func TestAdminRemoveWorker(t *testing.T) {
+	s, cancel := NewSyncTaskSystem(10)
+	defer cancel()
+	s.Start()
+	pool := NewWorkerPool()
+	h := NewAdminHandler(s, pool)
+
+	//移除執行中的worker時，任務執行完畢後才停止
+	var workers []WorkerView
+	require.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodPost, "/workers", &workers))
+	task := &slowTask{started: make(chan struct{}), dur: 200 * time.Millisecond}
+	handle := s.TaskInQueue(task)[0]
+	<-task.started
+	require.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodDelete, "/workers/"+workers[0].Id, &workers))
+	require.Empty(t, workers)
+	ctx, cancelWait := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelWait()
+	res, err := handle.Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, TaskSuccess, res.Code)
+
+	//AutoScaler管理的worker不可由admin移除
+	a := NewAutoScaler(s, pool, AutoScalerOption{MaxWorkers: 1})
+	a.scaleUp(1)
+	require.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodGet, "/workers", &workers))
+	require.Len(t, workers, 1)
+	require.Equal(t, http.StatusConflict, adminRequest(t, h, http.MethodDelete, "/workers/"+workers[0].Id, nil))
+	require.Len(t, s.GetWorkers(), 1)
+	require.Equal(t, 1, a.ManagedCount())
+}
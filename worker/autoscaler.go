@@ -0,0 +1,208 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/*
+AutoScaler 設定
+
+	MinWorkers: 最少活耀worker數
+	MaxWorkers: 最多活耀worker數
+	ScaleUpThreshold: 每個活耀worker可承受的通道待處理任務數，超過時從pool取出worker
+	CheckInterval: 檢查間隔
+	Logger: 未設定時使用DefaultLogger
+*/
+type AutoScalerOption struct {
+	MinWorkers       int
+	MaxWorkers       int
+	ScaleUpThreshold int
+	CheckInterval    time.Duration
+	Logger           Logger
+}
+
+/*
+控制活耀worker 與 worker pool 的互動關係
+
+  - 通道待處理任務數超過 活耀worker數*ScaleUpThreshold 時，從WorkerPool取出worker加入系統
+  - 通道為空時，將閒置(Idle且無待處理任務)的worker移出系統，等待worker結束後放回WorkerPool
+
+只會回收由AutoScaler自己從pool取出的worker，外部AddWorker加入的worker不受影響
+由AutoScaler管理的worker只能由AutoScaler回收，admin handler移除時回傳409
+*/
+type AutoScaler struct {
+	system  *SyncTaskSystem
+	pool    *WorkerPool
+	option  AutoScalerOption
+	logger  Logger
+	managed []*Worker
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+}
+
+func NewAutoScaler(system *SyncTaskSystem, pool *WorkerPool, option AutoScalerOption) *AutoScaler {
+	if option.MinWorkers < 0 {
+		option.MinWorkers = 0
+	}
+	if option.MaxWorkers < option.MinWorkers {
+		option.MaxWorkers = option.MinWorkers
+	}
+	if option.ScaleUpThreshold <= 0 {
+		option.ScaleUpThreshold = WorkerProcessTaskNum
+	}
+	if option.CheckInterval <= 0 {
+		option.CheckInterval = time.Second
+	}
+
+	logger := option.Logger
+	if logger == nil {
+		logger = newDefaultLogger()
+	}
+
+	a := &AutoScaler{
+		system: system,
+		pool:   pool,
+		option: option,
+		logger: logger,
+	}
+	system.registerAutoScaler(a)
+	return a
+}
+
+/*
+used go routine inside
+*/
+func (a *AutoScaler) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	a.mu.Lock()
+	a.cancel = cancel
+	a.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(a.option.CheckInterval)
+		defer ticker.Stop()
+		a.scale(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				a.scale(ctx)
+			}
+		}
+	}()
+}
+
+func (a *AutoScaler) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cancel != nil {
+		a.cancel()
+	}
+}
+
+// 目前由AutoScaler管理的worker數
+func (a *AutoScaler) ManagedCount() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.managed)
+}
+
+// w是否由AutoScaler管理
+func (a *AutoScaler) manages(w IWoker) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, m := range a.managed {
+		if IWoker(m) == w {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *SyncTaskSystem) registerAutoScaler(a *AutoScaler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.autoScalers = append(s.autoScalers, a)
+}
+
+// w是否由系統的任一AutoScaler管理，這類worker只能由AutoScaler回收
+func (s *SyncTaskSystem) autoScaled(w IWoker) bool {
+	s.mu.RLock()
+	scalers := s.autoScalers
+	s.mu.RUnlock()
+	for _, a := range scalers {
+		if a.manages(w) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *AutoScaler) scale(ctx context.Context) {
+	active := len(a.system.GetWorkers())
+	queued := a.system.lanes.len()
+
+	switch {
+	case active < a.option.MinWorkers:
+		a.scaleUp(a.option.MinWorkers - active)
+	case queued > active*a.option.ScaleUpThreshold && active < a.option.MaxWorkers:
+		need := (queued+a.option.ScaleUpThreshold-1)/a.option.ScaleUpThreshold - active
+		if need > a.option.MaxWorkers-active {
+			need = a.option.MaxWorkers - active
+		}
+		a.scaleUp(need)
+	case queued == 0 && active > a.option.MinWorkers:
+		a.scaleDown(ctx)
+	}
+}
+
+func (a *AutoScaler) scaleUp(n int) {
+	if n <= 0 {
+		return
+	}
+	workers := make([]IWoker, 0, n)
+	a.mu.Lock()
+	for i := 0; i < n; i++ {
+		w := a.pool.Get()
+		a.managed = append(a.managed, w)
+		workers = append(workers, w)
+	}
+	a.mu.Unlock()
+
+	a.system.AddWorker(workers...)
+	a.logger.Info(context.Background(), "autoscaler add %d workers", n)
+}
+
+// 每次只回收一個閒置worker，避免負載短暫下降時一次回收過多
+func (a *AutoScaler) scaleDown(ctx context.Context) {
+	a.mu.Lock()
+	var target *Worker
+	for i, w := range a.managed {
+		st := w.GetStatusData()
+		if st.Status == Idle && st.CurrentTaskCount == 0 {
+			target = w
+			a.managed = append(a.managed[:i], a.managed[i+1:]...)
+			break
+		}
+	}
+	a.mu.Unlock()
+
+	if target == nil {
+		return
+	}
+	if !a.system.RemoveWorker(target) {
+		return
+	}
+
+	go func() {
+		select {
+		case <-target.Done():
+			a.pool.Put(target)
+			a.logger.Info(ctx, "autoscaler return idle worker %s to pool", target.Id.String())
+		case <-ctx.Done():
+		}
+	}()
+}
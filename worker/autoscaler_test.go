@@ -0,0 +1,81 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type scaleTask struct{}
+
+func (t *scaleTask) Excute(context.Context) *TaskResult { return &TaskResult{Code: TaskSuccess} }
+func (t *scaleTask) HandleResult(*TaskResult)           {}
+func (t *scaleTask) GetTaskInfo() []byte                { return []byte(`{"task_name":"scale"}`) }
+
+func TestAutoScalerScaleUp(t *testing.T) {
+	//系統未啟動，任務保留在通道
+	s, cancel := NewSyncTaskSystem(20)
+	defer cancel()
+	a := NewAutoScaler(s, NewWorkerPool(), AutoScalerOption{MinWorkers: 1, MaxWorkers: 3, ScaleUpThreshold: 2})
+
+	//低於MinWorkers時補足
+	a.scale(context.Background())
+	require.Equal(t, 1, a.ManagedCount())
+	require.Len(t, s.GetWorkers(), 1)
+
+	tasks := make([]WorkerTask, 10)
+	for i := range tasks {
+		tasks[i] = &scaleTask{}
+	}
+	s.TaskInQueue(tasks...)
+	require.Eventually(t, func() bool { return s.lanes.len() == 10 }, time.Second, 10*time.Millisecond)
+
+	//需要5個worker，以MaxWorkers為上限
+	a.scale(context.Background())
+	require.Equal(t, 3, a.ManagedCount())
+	a.scale(context.Background())
+	require.Len(t, s.GetWorkers(), 3)
+}
+
+func TestAutoScalerScaleDown(t *testing.T) {
+	s, cancel := NewSyncTaskSystem(10)
+	defer cancel()
+	s.Start()
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	a := NewAutoScaler(s, NewWorkerPool(), AutoScalerOption{MinWorkers: 1, MaxWorkers: 3})
+	a.scaleUp(3)
+	require.Len(t, s.GetWorkers(), 3)
+
+	//沒有閒置worker時不回收
+	a.scale(ctx)
+	require.Equal(t, 3, a.ManagedCount())
+
+	a.mu.Lock()
+	managed := append([]*Worker(nil), a.managed...)
+	a.mu.Unlock()
+	done := managed[0].Done()
+	for _, w := range managed {
+		w.status.Store(Idle)
+	}
+
+	//每次回收一個，不低於MinWorkers
+	a.scale(ctx)
+	require.Equal(t, 2, a.ManagedCount())
+	require.Len(t, s.GetWorkers(), 2)
+	require.Eventually(t, func() bool {
+		select {
+		case <-done:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+
+	a.scale(ctx)
+	a.scale(ctx)
+	require.Equal(t, 1, a.ManagedCount())
+	require.Len(t, s.GetWorkers(), 1)
+}
@@ -0,0 +1,105 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+/*
+任務編解碼，用於將任務寫入永久儲存或送往遠端後還原
+*/
+type TaskCodec interface {
+	Encode(task WorkerTask) ([]byte, error)
+	Decode(data []byte) (WorkerTask, error)
+}
+
+/*
+以GetTaskInfo()作為編碼結果的TaskCodec
+解碼時將TaskInfo交給func還原為任務
+*/
+type TaskInfoCodec func(info TaskInfo) (WorkerTask, error)
+
+func (f TaskInfoCodec) Encode(task WorkerTask) ([]byte, error) {
+	return task.GetTaskInfo(), nil
+}
+
+func (f TaskInfoCodec) Decode(data []byte) (WorkerTask, error) {
+	var info TaskInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("unmarshal task info failed: %w", err)
+	}
+	return f(info)
+}
+
+/*
+以BaseTaskInfo.TaskName為key的TaskCodec註冊表
+*/
+type TaskCodecRegistry struct {
+	codecs map[string]TaskCodec
+	mu     sync.RWMutex
+}
+
+func NewTaskCodecRegistry() *TaskCodecRegistry {
+	return &TaskCodecRegistry{
+		codecs: make(map[string]TaskCodec),
+	}
+}
+
+// 註冊TaskName對應的codec，重複註冊會回傳錯誤
+func (r *TaskCodecRegistry) Register(taskName string, codec TaskCodec) error {
+	if taskName == "" {
+		return fmt.Errorf("task name cannot be empty")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.codecs[taskName]; ok {
+		return fmt.Errorf("codec for task %s already registered", taskName)
+	}
+	r.codecs[taskName] = codec
+	return nil
+}
+
+func (r *TaskCodecRegistry) get(taskName string) (TaskCodec, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	codec, ok := r.codecs[taskName]
+	if !ok {
+		return nil, fmt.Errorf("codec for task %s not registered", taskName)
+	}
+	return codec, nil
+}
+
+/*
+依任務的TaskName編碼
+
+	return:
+		taskName: 從GetTaskInfo()解析出的TaskName
+		data: 編碼結果
+*/
+func (r *TaskCodecRegistry) Encode(task WorkerTask) (string, []byte, error) {
+	taskName := taskNameOf(task)
+	codec, err := r.get(taskName)
+	if err != nil {
+		return taskName, nil, err
+	}
+	data, err := codec.Encode(task)
+	if err != nil {
+		return taskName, nil, fmt.Errorf("encode task %s failed: %w", taskName, err)
+	}
+	return taskName, data, nil
+}
+
+func (r *TaskCodecRegistry) Decode(taskName string, data []byte) (WorkerTask, error) {
+	codec, err := r.get(taskName)
+	if err != nil {
+		return nil, err
+	}
+	task, err := codec.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode task %s failed: %w", taskName, err)
+	}
+	return task, nil
+}
+
+var _ TaskCodec = TaskInfoCodec(nil)
@@ -0,0 +1,324 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// 節點失敗時DAG的處理方式
+type DAGFailurePolicy int
+
+const (
+	DAGFailFast       DAGFailurePolicy = iota //任一節點失敗即取消所有未完成節點
+	DAGSkipDependents                         //略過失敗節點的所有下游，其他分支繼續執行
+	DAGContinue                               //下游照常執行，可由上游結果自行判斷
+)
+
+type DAGNodeStatus int
+
+const (
+	DAGNodePending DAGNodeStatus = iota
+	DAGNodeRunning
+	DAGNodeSucceeded
+	DAGNodeFailed
+	DAGNodeSkipped
+	DAGNodeCanceled
+)
+
+/*
+依上游結果建立節點任務
+
+	upstream: key為上游節點id，只包含直接上游
+*/
+type DAGNodeFunc func(upstream map[string]*TaskResult) (WorkerTask, error)
+
+// 任務可選擇實作DAGTask，送出前會收到直接上游節點的結果
+type DAGTask interface {
+	WorkerTask
+	SetUpstreamResults(upstream map[string]*TaskResult)
+}
+
+type dagNode struct {
+	id    string
+	deps  []string
+	build DAGNodeFunc
+}
+
+/*
+任務相依圖
+節點為WorkerTask，上游節點的TaskResult(包含Response)會傳給下游
+整張圖透過Submit送往SyncTaskSystem，並以DAGRun等待完成
+*/
+type DAG struct {
+	nodes  map[string]*dagNode
+	order  []string
+	policy DAGFailurePolicy
+}
+
+func NewDAG(policy DAGFailurePolicy) *DAG {
+	return &DAG{
+		nodes:  make(map[string]*dagNode),
+		policy: policy,
+	}
+}
+
+/*
+新增固定任務節點，任務實作DAGTask時會在送出前收到上游結果
+
+	deps: 上游節點id，需先加入
+*/
+func (d *DAG) AddTask(id string, task WorkerTask, deps ...string) error {
+	return d.AddNode(id, func(upstream map[string]*TaskResult) (WorkerTask, error) {
+		if t, ok := task.(DAGTask); ok {
+			t.SetUpstreamResults(upstream)
+		}
+		return task, nil
+	}, deps...)
+}
+
+/*
+新增由上游結果建立任務的節點
+
+	deps: 上游節點id，需先加入，因此圖不會有循環
+*/
+func (d *DAG) AddNode(id string, build DAGNodeFunc, deps ...string) error {
+	if id == "" {
+		return fmt.Errorf("dag node id cannot be empty")
+	}
+	if _, ok := d.nodes[id]; ok {
+		return fmt.Errorf("dag node %s already exists", id)
+	}
+	for _, dep := range deps {
+		if _, ok := d.nodes[dep]; !ok {
+			return fmt.Errorf("dag node %s depends on unknown node %s", id, dep)
+		}
+	}
+	d.nodes[id] = &dagNode{
+		id:    id,
+		deps:  append([]string(nil), deps...),
+		build: build,
+	}
+	d.order = append(d.order, id)
+	return nil
+}
+
+// DAG執行結果
+type DAGResult struct {
+	Results map[string]*TaskResult   `json:"results"`
+	Status  map[string]DAGNodeStatus `json:"status"`
+	Err     error                    `json:"-"` //第一個失敗節點的錯誤
+}
+
+// 執行中的DAG
+type DAGRun struct {
+	dag       *DAG
+	system    *SyncTaskSystem
+	result    *DAGResult
+	handles   map[string]*TaskHandle
+	pending   map[string]int      //尚未完成的上游數
+	children  map[string][]string //下游節點
+	remaining int
+	events    chan dagEvent
+	cancel    chan struct{}
+	once      sync.Once
+	done      chan struct{}
+	mu        sync.Mutex
+}
+
+type dagEvent struct {
+	id  string
+	res *TaskResult
+}
+
+/*
+將DAG送往SyncTaskSystem執行
+沒有上游的節點會立即送出，其餘節點在上游全部完成後送出
+*/
+func (d *DAG) Submit(s *SyncTaskSystem) (*DAGRun, error) {
+	if len(d.nodes) == 0 {
+		return nil, fmt.Errorf("dag has no node")
+	}
+
+	r := &DAGRun{
+		dag:    d,
+		system: s,
+		result: &DAGResult{
+			Results: make(map[string]*TaskResult, len(d.nodes)),
+			Status:  make(map[string]DAGNodeStatus, len(d.nodes)),
+		},
+		handles:   make(map[string]*TaskHandle),
+		pending:   make(map[string]int, len(d.nodes)),
+		children:  make(map[string][]string, len(d.nodes)),
+		remaining: len(d.nodes),
+		events:    make(chan dagEvent, len(d.nodes)),
+		cancel:    make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	for _, id := range d.order {
+		node := d.nodes[id]
+		r.result.Status[id] = DAGNodePending
+		r.pending[id] = len(node.deps)
+		for _, dep := range node.deps {
+			r.children[dep] = append(r.children[dep], id)
+		}
+	}
+
+	go r.run()
+	return r, nil
+}
+
+// 取消尚未完成的節點，執行中的任務會被Cancel
+func (r *DAGRun) Cancel() {
+	r.once.Do(func() {
+		close(r.cancel)
+	})
+}
+
+func (r *DAGRun) Done() <-chan struct{} {
+	return r.done
+}
+
+// 等待DAG完成，ctx結束時回傳ctx.Err()，DAG仍會繼續執行
+func (r *DAGRun) Wait(ctx context.Context) (*DAGResult, error) {
+	select {
+	case <-r.done:
+		return r.result, r.result.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (r *DAGRun) run() {
+	defer close(r.done)
+
+	for _, id := range r.dag.order {
+		if r.pending[id] == 0 {
+			r.start(id)
+		}
+	}
+
+	for r.remaining > 0 {
+		select {
+		case <-r.cancel:
+			r.cancelAll(fmt.Errorf("dag canceled"))
+			return
+		case ev := <-r.events:
+			r.complete(ev.id, ev.res)
+		}
+	}
+}
+
+// 建立並送出節點任務，任務完成時送出事件
+func (r *DAGRun) start(id string) {
+	node := r.dag.nodes[id]
+	upstream := make(map[string]*TaskResult, len(node.deps))
+	for _, dep := range node.deps {
+		upstream[dep] = r.result.Results[dep]
+	}
+
+	task, err := node.build(upstream)
+	if err != nil || task == nil {
+		if err == nil {
+			err = fmt.Errorf("dag node %s build nil task", id)
+		}
+		r.setStatus(id, DAGNodeRunning)
+		r.events <- dagEvent{id: id, res: &TaskResult{Code: TaskFailed, Error: err}}
+		return
+	}
+
+	handle := r.system.TaskInQueue(task)[0]
+	r.mu.Lock()
+	r.handles[id] = handle
+	r.result.Status[id] = DAGNodeRunning
+	r.mu.Unlock()
+	go func() {
+		<-handle.Done()
+		r.events <- dagEvent{id: id, res: handle.Result()}
+	}()
+}
+
+// 節點完成後依結果與失敗策略決定下游節點
+func (r *DAGRun) complete(id string, res *TaskResult) {
+	r.remaining--
+	r.result.Results[id] = res
+	if res.Code == TaskSuccess {
+		r.setStatus(id, DAGNodeSucceeded)
+	} else {
+		r.setStatus(id, DAGNodeFailed)
+		if r.result.Err == nil {
+			r.result.Err = fmt.Errorf("dag node %s failed: %v", id, res.Error)
+		}
+		switch r.dag.policy {
+		case DAGFailFast:
+			r.cancelAll(r.result.Err)
+			return
+		case DAGSkipDependents:
+			r.skip(id)
+			return
+		}
+	}
+
+	for _, child := range r.children[id] {
+		r.pending[child]--
+		if r.pending[child] == 0 && r.status(child) == DAGNodePending {
+			r.start(child)
+		}
+	}
+}
+
+// 將id所有下游節點標記為略過
+func (r *DAGRun) skip(id string) {
+	for _, child := range r.children[id] {
+		if r.status(child) != DAGNodePending {
+			continue
+		}
+		r.setStatus(child, DAGNodeSkipped)
+		r.remaining--
+		r.skip(child)
+	}
+}
+
+// 取消所有執行中的任務，未開始的節點標記為取消
+func (r *DAGRun) cancelAll(cause error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, status := range r.result.Status {
+		switch status {
+		case DAGNodeRunning:
+			if h, ok := r.handles[id]; ok {
+				h.Cancel()
+			}
+			r.result.Status[id] = DAGNodeCanceled
+		case DAGNodePending:
+			r.result.Status[id] = DAGNodeCanceled
+		}
+	}
+	if r.result.Err == nil {
+		r.result.Err = cause
+	}
+	r.remaining = 0
+}
+
+func (r *DAGRun) status(id string) DAGNodeStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.result.Status[id]
+}
+
+func (r *DAGRun) setStatus(id string, status DAGNodeStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.result.Status[id] = status
+}
+
+// 回傳各節點目前狀態
+func (r *DAGRun) Status() map[string]DAGNodeStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make(map[string]DAGNodeStatus, len(r.result.Status))
+	for id, status := range r.result.Status {
+		res[id] = status
+	}
+	return res
+}
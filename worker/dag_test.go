@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type valueTask struct {
+	value int
+	err   error
+}
+
+func (t *valueTask) Excute(context.Context) *TaskResult {
+	if t.err != nil {
+		return &TaskResult{Code: TaskFailed, Error: t.err}
+	}
+	return &TaskResult{Code: TaskSuccess, Response: t.value}
+}
+func (t *valueTask) HandleResult(*TaskResult) {}
+func (t *valueTask) GetTaskInfo() []byte      { return []byte(`{"task_name":"value"}`) }
+
+func newDAGTestSystem(t *testing.T) *SyncTaskSystem {
+	s, cancel := NewSyncTaskSystem(10)
+	t.Cleanup(cancel)
+	s.AddWorker(NewWorker(WorkerOption{}), NewWorker(WorkerOption{}))
+	s.Start()
+	return s
+}
+
+func TestDAGPassUpstreamResults(t *testing.T) {
+	s := newDAGTestSystem(t)
+
+	d := NewDAG(DAGFailFast)
+	require.NoError(t, d.AddTask("a", &valueTask{value: 1}))
+	require.NoError(t, d.AddTask("b", &valueTask{value: 2}))
+	require.NoError(t, d.AddNode("c", func(upstream map[string]*TaskResult) (WorkerTask, error) {
+		return &valueTask{value: upstream["a"].Response.(int) + upstream["b"].Response.(int)}, nil
+	}, "a", "b"))
+	require.Error(t, d.AddTask("d", &valueTask{}, "unknown"))
+
+	run, err := d.Submit(s)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := run.Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 3, res.Results["c"].Response)
+	require.Equal(t, DAGNodeSucceeded, res.Status["c"])
+}
+
+func TestDAGFailurePolicy(t *testing.T) {
+	s := newDAGTestSystem(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	build := func(policy DAGFailurePolicy) *DAG {
+		d := NewDAG(policy)
+		require.NoError(t, d.AddTask("bad", &valueTask{err: errors.New("boom")}))
+		require.NoError(t, d.AddTask("after_bad", &valueTask{value: 1}, "bad"))
+		require.NoError(t, d.AddTask("leaf", &valueTask{value: 1}, "after_bad"))
+		return d
+	}
+
+	run, err := build(DAGSkipDependents).Submit(s)
+	require.NoError(t, err)
+	res, err := run.Wait(ctx)
+	require.Error(t, err)
+	require.Equal(t, DAGNodeFailed, res.Status["bad"])
+	require.Equal(t, DAGNodeSkipped, res.Status["after_bad"])
+	require.Equal(t, DAGNodeSkipped, res.Status["leaf"])
+
+	run, err = build(DAGContinue).Submit(s)
+	require.NoError(t, err)
+	res, err = run.Wait(ctx)
+	require.Error(t, err)
+	require.Equal(t, DAGNodeSucceeded, res.Status["leaf"])
+
+	run, err = build(DAGFailFast).Submit(s)
+	require.NoError(t, err)
+	res, err = run.Wait(ctx)
+	require.Error(t, err)
+	require.Equal(t, DAGNodeCanceled, res.Status["after_bad"])
+}
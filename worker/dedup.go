@@ -0,0 +1,266 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrDuplicateTask = errors.New("duplicate task suppressed")
+
+// 任務可選擇實作IdempotentTask提供冪等鍵，未實作時使用BaseTaskInfo.IdempotencyKey
+type IdempotentTask interface {
+	GetIdempotencyKey() string
+}
+
+// 重複任務的處理方式
+type DedupMode int
+
+const (
+	DedupDrop     DedupMode = iota //重複任務不執行，handle以ErrDuplicateTask完成
+	DedupCoalesce                  //重複任務合併至原任務，回傳原任務的handle，原任務已成功時保留至冪等鍵過期
+)
+
+/*
+冪等鍵儲存，可替換為redis等共用儲存讓多個系統共同去重
+*/
+type DedupStore interface {
+	/*
+		key在期限內不存在時寫入並回傳true
+		已存在時回傳false與先前寫入的taskId
+	*/
+	SetIfAbsent(key, taskId string, ttl time.Duration) (bool, string, error)
+	/*
+		原任務沒有成功時釋放key，讓之後的相同任務可以再執行
+		只有key目前屬於taskId時刪除，避免刪除其他任務寫入的key
+	*/
+	Release(key, taskId string) error
+}
+
+type dedupEntry struct {
+	taskId    string
+	expiresAt time.Time
+}
+
+// 以記憶體保存冪等鍵，過期的鍵在存取時清除
+type MemoryDedupStore struct {
+	entries   map[string]dedupEntry
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+func NewMemoryDedupStore() *MemoryDedupStore {
+	return &MemoryDedupStore{
+		entries:   make(map[string]dedupEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *MemoryDedupStore) SetIfAbsent(key, taskId string, ttl time.Duration) (bool, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.sweep(now, ttl)
+	if e, ok := m.entries[key]; ok && now.Before(e.expiresAt) {
+		return false, e.taskId, nil
+	}
+	m.entries[key] = dedupEntry{taskId: taskId, expiresAt: now.Add(ttl)}
+	return true, taskId, nil
+}
+
+func (m *MemoryDedupStore) Release(key, taskId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.entries[key]; ok && e.taskId == taskId {
+		delete(m.entries, key)
+	}
+	return nil
+}
+
+// 每經過一個期限清除一次過期的鍵，呼叫端需持有mu
+func (m *MemoryDedupStore) sweep(now time.Time, ttl time.Duration) {
+	if now.Sub(m.lastSweep) < ttl {
+		return
+	}
+	for key, e := range m.entries {
+		if !now.Before(e.expiresAt) {
+			delete(m.entries, key)
+		}
+	}
+	m.lastSweep = now
+}
+
+// 目前保存的鍵數(包含尚未清除的過期鍵)
+func (m *MemoryDedupStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
+
+var _ DedupStore = (*MemoryDedupStore)(nil)
+
+type dedupConfig struct {
+	store  DedupStore
+	window time.Duration
+	mode   DedupMode
+}
+
+/*
+啟用任務去重，相同冪等鍵的任務在window內只會執行一次
+沒有冪等鍵的任務不去重，DedupStore發生錯誤時任務照常執行
+原任務沒有成功(失敗、逾時、取消、被拒絕或系統關閉時放棄)時釋放冪等鍵，之後的相同任務可以再執行
+
+	window: 冪等鍵保存期限，自第一次送入開始計算
+*/
+func WithDedup(store DedupStore, window time.Duration, mode DedupMode) SystemOption {
+	return func(cfg *systemConfig) {
+		cfg.dedup = &dedupConfig{
+			store:  store,
+			window: window,
+			mode:   mode,
+		}
+	}
+}
+
+// 任務的冪等鍵，沒有時回傳空字串
+func idempotencyKeyOf(task WorkerTask) string {
+	if t, ok := task.(IdempotentTask); ok {
+		return t.GetIdempotencyKey()
+	}
+	var info BaseTaskInfo
+	if err := json.Unmarshal(task.GetTaskInfo(), &info); err != nil {
+		return ""
+	}
+	return info.IdempotencyKey
+}
+
+/*
+檢查任務是否重複
+key已屬於id時(同一個遠端訊息重新投遞)不視為重複
+
+	id: 任務不重複時使用的handle id
+	return:
+		dup: 是否重複
+		originId: 重複時原任務的handle id
+*/
+func (s *SyncTaskSystem) deduplicate(task WorkerTask, id string) (dup bool, originId string) {
+	if s.dedup == nil {
+		return false, ""
+	}
+	key := idempotencyKeyOf(task)
+	if key == "" {
+		return false, ""
+	}
+	ok, originId, err := s.dedup.store.SetIfAbsent(key, id, s.dedup.window)
+	if err != nil {
+		s.logger.Warn(s.ctx, "dedup store failed, task not deduplicated, err : %s", err.Error())
+		return false, ""
+	}
+	if ok || originId == id {
+		return false, ""
+	}
+	s.suppressed.Add(1)
+	return true, originId
+}
+
+/*
+重複任務回傳給呼叫端的handle
+合併模式下回傳原任務的handle，原任務已完成時回傳保留的handle
+原任務不在本系統(共用DedupStore的其他系統)或handle已過期時以ErrDuplicateTask完成
+*/
+func (s *SyncTaskSystem) duplicateHandle(task WorkerTask, originId string) *TaskHandle {
+	if s.dedup.mode == DedupCoalesce {
+		s.inflightMu.Lock()
+		defer s.inflightMu.Unlock()
+		if origin, found := s.inflight[originId]; found {
+			return origin.handle
+		}
+		if c, found := s.coalesced[originId]; found && time.Now().Before(c.expiresAt) {
+			return c.handle
+		}
+	}
+	return rejectedHandles([]WorkerTask{task}, ErrDuplicateTask)[0]
+}
+
+// 合併模式下已成功的原任務handle
+type coalescedHandle struct {
+	handle    *TaskHandle
+	expiresAt time.Time
+}
+
+/*
+合併模式下保留已成功的原任務handle，讓冪等鍵過期前的重複任務取得原任務的結果
+保留期限為完成後一個window，不短於冪等鍵的期限，每經過一個window清除一次過期的handle
+呼叫端需持有inflightMu
+*/
+func (s *SyncTaskSystem) keepCoalesced(task WorkerTask, h *TaskHandle) {
+	if s.dedup == nil || s.dedup.mode != DedupCoalesce || idempotencyKeyOf(task) == "" {
+		return
+	}
+	now := time.Now()
+	if s.coalesced == nil {
+		s.coalesced = make(map[string]coalescedHandle)
+		s.lastSweep = now
+	}
+	if now.Sub(s.lastSweep) >= s.dedup.window {
+		for id, c := range s.coalesced {
+			if !now.Before(c.expiresAt) {
+				delete(s.coalesced, id)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.coalesced[h.Id] = coalescedHandle{handle: h, expiresAt: now.Add(s.dedup.window)}
+}
+
+// 原任務沒有成功時釋放冪等鍵
+func (s *SyncTaskSystem) releaseDedup(task WorkerTask, id string) {
+	if s.dedup == nil {
+		return
+	}
+	key := idempotencyKeyOf(task)
+	if key == "" {
+		return
+	}
+	if err := s.dedup.store.Release(key, id); err != nil {
+		s.logger.Warn(s.ctx, "release dedup key failed, err : %s", err.Error())
+	}
+}
+
+/*
+過濾重複任務
+
+	return:
+		handles: 與tasks順序相同，重複任務已填入handle
+		accepted: 不重複的任務
+		ids: accepted對應的handle id
+		idx: accepted在tasks中的位置
+		aliases: 合併模式下與同一批accepted任務重複的任務，tasks位置 -> accepted位置，需在接收後填入原任務handle
+*/
+func (s *SyncTaskSystem) filterDuplicates(tasks []WorkerTask) (handles []*TaskHandle, accepted []WorkerTask, ids []string, idx []int, aliases map[int]int) {
+	handles = make([]*TaskHandle, len(tasks))
+	batch := make(map[string]int)
+	for i, task := range tasks {
+		id := uuid.New().String()
+		dup, originId := s.deduplicate(task, id)
+		if !dup {
+			batch[id] = len(accepted)
+			accepted = append(accepted, task)
+			ids = append(ids, id)
+			idx = append(idx, i)
+			continue
+		}
+		if pos, ok := batch[originId]; ok && s.dedup.mode == DedupCoalesce {
+			if aliases == nil {
+				aliases = make(map[int]int)
+			}
+			aliases[i] = pos
+			continue
+		}
+		handles[i] = s.duplicateHandle(task, originId)
+	}
+	return handles, accepted, ids, idx, aliases
+}
@@ -0,0 +1,164 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type keyedTask struct {
+	key      string
+	release  chan struct{}
+	err      error
+	executed *atomic.Int32
+}
+
+func (t *keyedTask) Excute(ctx context.Context) *TaskResult {
+	if t.release != nil {
+		<-t.release
+	}
+	if t.executed != nil {
+		t.executed.Add(1)
+	}
+	if t.err != nil {
+		return &TaskResult{Code: TaskFailed, Error: t.err}
+	}
+	return &TaskResult{Code: TaskSuccess}
+}
+func (t *keyedTask) HandleResult(*TaskResult) {}
+func (t *keyedTask) GetTaskInfo() []byte {
+	b, _ := json.Marshal(BaseTaskInfo{TaskName: "keyed", IdempotencyKey: t.key})
+	return b
+}
+
+func TestMemoryDedupStoreTTL(t *testing.T) {
+	store := NewMemoryDedupStore()
+	ok, id, err := store.SetIfAbsent("k", "a", 20*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "a", id)
+
+	ok, id, err = store.SetIfAbsent("k", "b", 20*time.Millisecond)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, "a", id)
+
+	time.Sleep(30 * time.Millisecond)
+	ok, _, err = store.SetIfAbsent("k", "c", 20*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 1, store.Len())
+
+	//只釋放屬於taskId的key
+	require.NoError(t, store.Release("k", "a"))
+	require.Equal(t, 1, store.Len())
+	require.NoError(t, store.Release("k", "c"))
+	require.Equal(t, 0, store.Len())
+}
+
+func TestSyncTaskSystemDedup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	drop, cancel1 := NewSyncTaskSystem(10, WithDedup(NewMemoryDedupStore(), time.Minute, DedupDrop))
+	defer cancel1()
+	drop.AddWorker(NewWorker(WorkerOption{}))
+	drop.Start()
+
+	handles := drop.TaskInQueue(&keyedTask{key: "order-1"}, &keyedTask{key: "order-1"}, &keyedTask{})
+	res, err := handles[1].Wait(ctx)
+	require.NoError(t, err)
+	require.ErrorIs(t, res.Error, ErrDuplicateTask)
+	for _, i := range []int{0, 2} {
+		res, err = handles[i].Wait(ctx)
+		require.NoError(t, err)
+		require.Equal(t, TaskSuccess, res.Code)
+	}
+	require.EqualValues(t, 1, drop.GetStatusData().SuppressedCount)
+
+	coalesce, cancel2 := NewSyncTaskSystem(10, WithDedup(NewMemoryDedupStore(), time.Minute, DedupCoalesce))
+	defer cancel2()
+	coalesce.AddWorker(NewWorker(WorkerOption{}))
+	coalesce.Start()
+
+	release := make(chan struct{})
+	first := coalesce.TaskInQueue(&keyedTask{key: "order-2", release: release})[0]
+	second := coalesce.TaskInQueue(&keyedTask{key: "order-2"})[0]
+	require.Same(t, first, second)
+	close(release)
+	res, err = second.Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, TaskSuccess, res.Code)
+	require.EqualValues(t, 1, coalesce.GetStatusData().SuppressedCount)
+}
+
+func TestSyncTaskSystemDedupReleaseAndBatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s, cancel1 := NewSyncTaskSystem(10, WithDedup(NewMemoryDedupStore(), time.Minute, DedupCoalesce))
+	defer cancel1()
+	s.AddWorker(NewWorker(WorkerOption{}))
+	s.Start()
+
+	//同一批送入的重複任務合併至第一個任務
+	var executed atomic.Int32
+	handles := s.TaskInQueue(&keyedTask{key: "order-3", executed: &executed}, &keyedTask{key: "order-3", executed: &executed})
+	require.Same(t, handles[0], handles[1])
+	res, err := handles[0].Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, TaskSuccess, res.Code)
+	require.EqualValues(t, 1, executed.Load())
+
+	//原任務失敗時釋放key，之後的相同任務可以再執行
+	res, err = s.TaskInQueue(&keyedTask{key: "order-4", err: errors.New("boom")})[0].Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, TaskFailed, res.Code)
+	res, err = s.TaskInQueue(&keyedTask{key: "order-4"})[0].Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, TaskSuccess, res.Code)
+
+	//原任務成功後，冪等鍵過期前的重複任務取得原任務的結果
+	origin := s.TaskInQueue(&keyedTask{key: "order-8", executed: &executed})[0]
+	res, err = origin.Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, TaskSuccess, res.Code)
+	dup := s.TaskInQueue(&keyedTask{key: "order-8", executed: &executed})[0]
+	require.Same(t, origin, dup)
+	require.Same(t, res, dup.Result())
+	require.EqualValues(t, 2, executed.Load())
+}
+
+func TestSyncTaskSystemDedupRemote(t *testing.T) {
+	broker := &fakeBroker{queue: make(chan []byte, 10), acked: make(chan error, 10)}
+	var executed atomic.Int32
+	codecs := NewTaskCodecRegistry()
+	require.NoError(t, codecs.Register("keyed", TaskInfoCodec(func(info TaskInfo) (WorkerTask, error) {
+		return &keyedTask{key: info.IdempotencyKey, executed: &executed}, nil
+	})))
+
+	publisher, cancel1 := NewSyncTaskSystem(10, WithTaskCodecs(codecs), WithRemotePublisher(broker, "tasks", "keyed"))
+	defer cancel1()
+	remote, cancel2 := NewSyncTaskSystem(10, WithTaskCodecs(codecs), WithDedup(NewMemoryDedupStore(), time.Minute, DedupDrop))
+	defer cancel2()
+	remote.AddWorker(NewWorker(WorkerOption{}))
+	remote.Start()
+	require.NoError(t, remote.ConsumeRemote(broker, "tasks", "worker"))
+
+	publisher.TaskInQueue(&keyedTask{key: "order-5"}, &keyedTask{key: "order-5"})
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-broker.acked:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("remote task not acked")
+		}
+	}
+	require.EqualValues(t, 1, executed.Load())
+	require.EqualValues(t, 1, remote.GetStatusData().SuppressedCount)
+}
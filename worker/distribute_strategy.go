@@ -0,0 +1,114 @@
+package worker
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+/*
+分配策略，由distributor依各worker的GetStatusData()決定下一組任務給誰
+
+	Next:
+		stats: 與SyncTaskSystem.workers順序相同的worker狀態
+		batchSize: 一組任務最大數量
+	return:
+		idx: 分配對象在stats中的index，<0 表示目前沒有可分配的worker
+		size: 本次分配任務數量
+*/
+type DistributeStrategy interface {
+	Next(stats []WorkerStaticsData, batchSize int) (idx int, size int)
+}
+
+// 依序輪流分配完整的一組任務，略過已停止的worker
+type RoundRobinStrategy struct {
+	next atomic.Uint64
+}
+
+func NewRoundRobinStrategy() *RoundRobinStrategy {
+	return &RoundRobinStrategy{}
+}
+
+func (r *RoundRobinStrategy) Next(stats []WorkerStaticsData, batchSize int) (int, int) {
+	n := len(stats)
+	for i := 0; i < n; i++ {
+		idx := int(r.next.Add(1)-1) % n
+		if stats[idx].Status != Stop {
+			return idx, batchSize
+		}
+	}
+	return -1, 0
+}
+
+// 分配給待處理任務數最少的worker，每次只補滿到batchSize
+// 待處理任務數已達batchSize的worker不會再分配
+type LeastQueuedStrategy struct{}
+
+func NewLeastQueuedStrategy() *LeastQueuedStrategy {
+	return &LeastQueuedStrategy{}
+}
+
+func (l *LeastQueuedStrategy) Next(stats []WorkerStaticsData, batchSize int) (int, int) {
+	idx := -1
+	for i, st := range stats {
+		if st.Status == Stop || st.CurrentTaskCount >= batchSize {
+			continue
+		}
+		if idx < 0 || st.CurrentTaskCount < stats[idx].CurrentTaskCount {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return -1, 0
+	}
+	return idx, batchSize - stats[idx].CurrentTaskCount
+}
+
+/*
+分配給預期最快完成手上任務的worker
+預期完成時間 = 待處理任務數 * 平均執行時間，尚無執行紀錄的worker視為0
+
+分配數量會依與最快worker的平均執行時間比例縮小，慢的worker拿到較小的批次
+*/
+type ShortestExpectedCompletionStrategy struct{}
+
+func NewShortestExpectedCompletionStrategy() *ShortestExpectedCompletionStrategy {
+	return &ShortestExpectedCompletionStrategy{}
+}
+
+func (sc *ShortestExpectedCompletionStrategy) Next(stats []WorkerStaticsData, batchSize int) (int, int) {
+	idx := -1
+	var best time.Duration
+	var fastest time.Duration
+	for i, st := range stats {
+		if st.Status == Stop || st.CurrentTaskCount >= batchSize {
+			continue
+		}
+		if st.AverageExecutionTime > 0 && (fastest == 0 || st.AverageExecutionTime < fastest) {
+			fastest = st.AverageExecutionTime
+		}
+		expected := time.Duration(st.CurrentTaskCount) * st.AverageExecutionTime
+		//預期時間相同時，選待處理任務數較少者
+		if idx < 0 || expected < best || (expected == best && st.CurrentTaskCount < stats[idx].CurrentTaskCount) {
+			idx = i
+			best = expected
+		}
+	}
+	if idx < 0 {
+		return -1, 0
+	}
+
+	size := batchSize - stats[idx].CurrentTaskCount
+	if avg := stats[idx].AverageExecutionTime; avg > 0 && fastest > 0 {
+		size = int(int64(size) * int64(fastest) / int64(avg))
+	}
+	if size < 1 {
+		size = 1
+	}
+	return idx, size
+}
+
+var (
+	_ DistributeStrategy = (*RoundRobinStrategy)(nil)
+	_ DistributeStrategy = (*LeastQueuedStrategy)(nil)
+	_ DistributeStrategy = (*ShortestExpectedCompletionStrategy)(nil)
+)
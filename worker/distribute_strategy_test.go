@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// 回傳固定狀態的IWoker
+type stubWorker struct {
+	stats WorkerStaticsData
+}
+
+func (w *stubWorker) Run(context.Context)              {}
+func (w *stubWorker) FeedTask([]WorkerTask) bool       { return true }
+func (w *stubWorker) GetStatusData() WorkerStaticsData { return w.stats }
+func (w *stubWorker) Reset()                           {}
+
+func TestDistributeStrategies(t *testing.T) {
+	type pick struct {
+		idx, size int
+	}
+	running := func(queued int, avg time.Duration) *stubWorker {
+		return &stubWorker{stats: WorkerStaticsData{Status: Running, CurrentTaskCount: queued, AverageExecutionTime: avg}}
+	}
+	stopped := &stubWorker{stats: WorkerStaticsData{Status: Stop}}
+
+	cases := []struct {
+		name      string
+		strategy  DistributeStrategy
+		workers   []IWoker
+		batchSize int
+		want      []pick
+	}{
+		{
+			name:      "round robin skips stopped",
+			strategy:  NewRoundRobinStrategy(),
+			workers:   []IWoker{running(0, 0), stopped, running(5, 0)},
+			batchSize: 4,
+			want:      []pick{{0, 4}, {2, 4}, {0, 4}},
+		},
+		{
+			name:      "round robin all stopped",
+			strategy:  NewRoundRobinStrategy(),
+			workers:   []IWoker{stopped, stopped},
+			batchSize: 4,
+			want:      []pick{{-1, 0}},
+		},
+		{
+			name:      "least queued tops up",
+			strategy:  NewLeastQueuedStrategy(),
+			workers:   []IWoker{running(3, 0), running(1, 0), stopped},
+			batchSize: 4,
+			want:      []pick{{1, 3}},
+		},
+		{
+			name:      "least queued all full",
+			strategy:  NewLeastQueuedStrategy(),
+			workers:   []IWoker{running(4, 0), running(6, 0)},
+			batchSize: 4,
+			want:      []pick{{-1, 0}},
+		},
+		{
+			name:      "shortest expected completion prefers fast worker",
+			strategy:  NewShortestExpectedCompletionStrategy(),
+			workers:   []IWoker{running(1, 100*time.Millisecond), running(2, 10*time.Millisecond)},
+			batchSize: 10,
+			want:      []pick{{1, 8}},
+		},
+		{
+			name:      "shortest expected completion shrinks slow batch",
+			strategy:  NewShortestExpectedCompletionStrategy(),
+			workers:   []IWoker{running(0, 40*time.Millisecond), running(9, 10*time.Millisecond)},
+			batchSize: 10,
+			want:      []pick{{0, 2}},
+		},
+		{
+			name:      "shortest expected completion without history",
+			strategy:  NewShortestExpectedCompletionStrategy(),
+			workers:   []IWoker{running(2, 0), running(1, 0), stopped},
+			batchSize: 4,
+			want:      []pick{{1, 3}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			stats := make([]WorkerStaticsData, len(c.workers))
+			for i, w := range c.workers {
+				stats[i] = w.GetStatusData()
+			}
+			for _, want := range c.want {
+				idx, size := c.strategy.Next(stats, c.batchSize)
+				require.Equal(t, want, pick{idx, size})
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+/*
+單筆訊息的發送結果，與infra/mq/client.PublishFuture相容
+broker確認後以nil呼叫cb，nack、逾時等失敗時以對應錯誤呼叫
+*/
+type IRemotePublishFuture interface {
+	OnComplete(cb func(error))
+}
+
+/*
+分散式模式使用的發送端，與infra/mq/client.ThreadSafeProducer相容
+F為PublishAsync回傳的發送結果型別，傳入WithRemotePublisher時自動推導
+*/
+type IRemoteProducer[F IRemotePublishFuture] interface {
+	PublishAsync(exchange, routingKey string, message []byte) (F, error)
+}
+
+/*
+分散式模式使用的消費端，與infra/mq/client.IConsumer相容
+*/
+type IRemoteConsumer interface {
+	Consume(queueName, tag string, handler func([]byte) error) error
+}
+
+/*
+系統終止或關閉時無法處理的遠端訊息以此錯誤回傳
+實作Requeue() bool，infra/mq/client.ConsumerV2會以nack將訊息重新放回佇列，而不是ack後遺失
+*/
+type RemoteRequeueError struct {
+	Err error
+}
+
+func (e *RemoteRequeueError) Error() string { return "requeue remote task: " + e.Err.Error() }
+func (e *RemoteRequeueError) Unwrap() error { return e.Err }
+func (e *RemoteRequeueError) Requeue() bool { return true }
+
+/*
+分散式模式的發送設定
+TaskInQueue不在本地執行，而是將任務編碼後發送到exchange，由遠端系統以ConsumeRemote執行
+*/
+type remotePublisher struct {
+	publish func(message []byte, onComplete func(error)) error
+}
+
+/*
+設定任務codec，用於永久儲存與分散式模式的任務編碼與解碼
+*/
+func WithTaskCodecs(codecs *TaskCodecRegistry) SystemOption {
+	return func(cfg *systemConfig) {
+		cfg.codecs = codecs
+	}
+}
+
+/*
+啟用分散式發送模式，任務以codec編碼為QueueRecord(JSON)後發送，不在本地執行
+需同時以WithTaskCodecs或WithQueueStore設定codec，沒有註冊codec的任務會以TaskFailed完成
+
+	producer: 通常為client.ThreadSafeProducer，需先Start
+	exchange, routingKey: 發送目標
+
+TaskHandle在broker確認後以TaskPublished完成，任務的HandleResult不會被呼叫
+nack、確認逾時等發送失敗時以TaskFailed完成，並釋放去重key
+發送結果不會送給SubscribeResults的訂閱者，執行結果由遠端系統發布
+*/
+func WithRemotePublisher[F IRemotePublishFuture](producer IRemoteProducer[F], exchange, routingKey string) SystemOption {
+	return func(cfg *systemConfig) {
+		cfg.remote = &remotePublisher{
+			publish: func(message []byte, onComplete func(error)) error {
+				future, err := producer.PublishAsync(exchange, routingKey, message)
+				if err != nil {
+					return err
+				}
+				future.OnComplete(onComplete)
+				return nil
+			},
+		}
+	}
+}
+
+/*
+將任務編碼後發送，handle以broker的確認結果完成
+未Start的發送節點沒有分送結果的goroutine，因此不經過resultQueue
+
+	ids: 指定任務handle id，nil時自動產生
+*/
+func (s *SyncTaskSystem) publishRemote(lane *taskLane, tasks []WorkerTask, ids []string) []*TaskHandle {
+	handles := make([]*TaskHandle, len(tasks))
+	for i, task := range tasks {
+		name := taskNameOf(task)
+		h := newTaskHandle(name)
+		if ids != nil {
+			h.Id = ids[i]
+		}
+		s.pipeline.enqueue(s.ctx, task)
+		complete := func(err error) {
+			s.completePublish(h, task, err)
+		}
+		if err := s.publishTask(h.Id, lane, task, complete); err != nil {
+			complete(err)
+		}
+		handles[i] = h
+	}
+	return handles
+}
+
+// 以發送結果完成handle，失敗時釋放去重key，讓相同任務可以重新送入
+func (s *SyncTaskSystem) completePublish(h *TaskHandle, task WorkerTask, err error) {
+	res := &TaskResult{
+		TaskId:   h.Id,
+		TaskName: h.TaskName,
+		Code:     TaskPublished,
+	}
+	if err != nil {
+		s.logger.Error(s.ctx, "publish task %s failed, err : %s", h.Id, err.Error())
+		res.Code = TaskFailed
+		res.Error = err
+		s.releaseDedup(task, h.Id)
+	}
+	h.resolve(res)
+}
+
+func (s *SyncTaskSystem) publishTask(id string, lane *taskLane, task WorkerTask, onComplete func(error)) error {
+	if s.codecs == nil {
+		return fmt.Errorf("task codec registry not set")
+	}
+	taskName, data, err := s.codecs.Encode(task)
+	if err != nil {
+		return err
+	}
+	if lane == nil {
+		lane = s.lanes.laneOf(task)
+	}
+	body, err := json.Marshal(QueueRecord{
+		Id:         id,
+		Lane:       lane.name,
+		TaskName:   taskName,
+		Payload:    data,
+		EnqueuedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	return s.remote.publish(body, onComplete)
+}
+
+/*
+由consumer接收遠端發送的任務並在本地執行
+訊息以codec解碼為WorkerTask後放入系統，等待HandleResult完成後才回傳，consumer於回傳後ack
+有設定WithDedup時同樣去重，合併模式下等待原任務的結果
+
+	consumer: 通常為client.ConsumerV2，其prefetch為1，需要並行處理時可建立多個consumer
+	queueName, tag: 消費的佇列與消費者標籤
+*/
+func (s *SyncTaskSystem) ConsumeRemote(consumer IRemoteConsumer, queueName, tag string) error {
+	if s.codecs == nil {
+		return fmt.Errorf("task codec registry not set")
+	}
+	return consumer.Consume(queueName, tag, s.handleRemoteMessage)
+}
+
+/*
+處理一筆遠端任務訊息
+無法解碼的訊息回傳錯誤，任務執行失敗時回傳結果的錯誤
+系統終止或關閉而未執行完畢時回傳RemoteRequeueError，讓consumer將訊息放回佇列
+*/
+func (s *SyncTaskSystem) handleRemoteMessage(msg []byte) error {
+	var rec QueueRecord
+	if err := json.Unmarshal(msg, &rec); err != nil {
+		s.logger.Error(s.ctx, "decode remote task message failed, err : %s", err.Error())
+		return err
+	}
+	task, err := s.codecs.Decode(rec.TaskName, rec.Payload)
+	if err != nil {
+		s.logger.Error(s.ctx, "decode remote task %s failed, err : %s", rec.Id, err.Error())
+		return err
+	}
+	lane, ok := s.lanes.getLane(rec.Lane)
+	if !ok {
+		lane = s.lanes.defaultLane
+	}
+
+	//暫停接收期間不回傳，訊息保留在consumer直到恢復
+	if err := s.waitIntake(); err != nil {
+		return &RemoteRequeueError{Err: err}
+	}
+	var h *TaskHandle
+	if dup, originId := s.deduplicate(task, rec.Id); dup {
+		h = s.duplicateHandle(task, originId)
+	} else {
+		h = s.accept(lane, []WorkerTask{task}, []string{rec.Id})[0]
+	}
+	res, err := h.Wait(s.ctx)
+	if err != nil {
+		return &RemoteRequeueError{Err: err}
+	}
+	if errors.Is(res.Error, ErrSystemClosed) {
+		return &RemoteRequeueError{Err: res.Error}
+	}
+	//重複的訊息由原任務處理，直接ack
+	if errors.Is(res.Error, ErrDuplicateTask) {
+		return nil
+	}
+	if res.Code != TaskSuccess {
+		return fmt.Errorf("remote task %s failed: %v", rec.Id, res.Error)
+	}
+	return nil
+}
+
+// 等待恢復接收任務，系統終止時回傳ctx.Err()
+func (s *SyncTaskSystem) waitIntake() error {
+	if !s.IntakePaused() {
+		return nil
+	}
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for s.IntakePaused() {
+		select {
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
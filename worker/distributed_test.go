@@ -0,0 +1,182 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// 以chan模擬exchange與queue，ack紀錄handler回傳後的訊息
+// nack不為nil時訊息不放入queue，發送結果以nack完成
+type fakeBroker struct {
+	queue chan []byte
+	acked chan error
+	nack  error
+	hold  chan struct{} //不為nil時，關閉後才回傳發送結果
+}
+
+type fakePublishFuture struct {
+	err  error
+	hold chan struct{}
+}
+
+func (f *fakePublishFuture) OnComplete(cb func(error)) {
+	if f.hold == nil {
+		cb(f.err)
+		return
+	}
+	go func() {
+		<-f.hold
+		cb(f.err)
+	}()
+}
+
+func (b *fakeBroker) PublishAsync(exchange, routingKey string, message []byte) (*fakePublishFuture, error) {
+	if b.nack == nil {
+		b.queue <- message
+	}
+	return &fakePublishFuture{err: b.nack, hold: b.hold}, nil
+}
+
+func (b *fakeBroker) Consume(queueName, tag string, handler func([]byte) error) error {
+	go func() {
+		for msg := range b.queue {
+			b.acked <- handler(msg)
+		}
+	}()
+	return nil
+}
+
+func (b *fakeBroker) ReStart(queueName, tag string, handler func([]byte) error) error {
+	return b.Consume(queueName, tag, handler)
+}
+
+func (b *fakeBroker) Close() error { return nil }
+
+func TestSyncTaskSystemRemoteMode(t *testing.T) {
+	broker := &fakeBroker{queue: make(chan []byte, 10), acked: make(chan error, 10)}
+	done := make(chan string, 1)
+	codecs := NewTaskCodecRegistry()
+	require.NoError(t, codecs.Register("persist", TaskInfoCodec(func(info TaskInfo) (WorkerTask, error) {
+		task := &persistTask{done: done}
+		return task, json.Unmarshal(info.Metadata, &task.Value)
+	})))
+
+	publisher, cancel1 := NewSyncTaskSystem(10, WithTaskCodecs(codecs), WithRemotePublisher(broker, "tasks", "persist"))
+	defer cancel1()
+	remote, cancel2 := NewSyncTaskSystem(10, WithTaskCodecs(codecs))
+	defer cancel2()
+	remote.AddWorker(NewWorker(WorkerOption{}))
+	remote.Start()
+	require.NoError(t, remote.ConsumeRemote(broker, "tasks", "worker"))
+
+	handles := publisher.TaskInQueue(&persistTask{Value: "remote"}, &valueTask{value: 1})
+	require.Equal(t, TaskPublished, handles[0].Result().Code)
+	require.Equal(t, TaskFailed, handles[1].Result().Code) //沒有註冊codec
+
+	select {
+	case err := <-broker.acked:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("remote task not acked")
+	}
+	//ack前HandleResult已經執行
+	require.Equal(t, "remote", <-done)
+}
+
+func TestSyncTaskSystemRemotePublishOnly(t *testing.T) {
+	broker := &fakeBroker{queue: make(chan []byte, 10), acked: make(chan error, 10)}
+	codecs := NewTaskCodecRegistry()
+	require.NoError(t, codecs.Register("persist", TaskInfoCodec(func(info TaskInfo) (WorkerTask, error) {
+		return &persistTask{}, nil
+	})))
+
+	//未Start的發送節點，resultQueue大小為1，發送多筆不可阻塞
+	publisher, cancel := NewSyncTaskSystem(1, WithTaskCodecs(codecs), WithRemotePublisher(broker, "tasks", "persist"))
+	defer cancel()
+	sub := publisher.SubscribeResults(10, nil)
+	for i := 0; i < 5; i++ {
+		require.Equal(t, TaskPublished, publisher.TaskInQueue(&persistTask{Value: "remote"})[0].Result().Code)
+	}
+	require.Len(t, broker.queue, 5)
+	require.Len(t, sub.C(), 0)
+	require.Zero(t, publisher.GetStatusData().DroppedResults)
+}
+
+func TestSyncTaskSystemRemoteRequeueOnShutdown(t *testing.T) {
+	broker := &fakeBroker{queue: make(chan []byte, 10), acked: make(chan error, 10)}
+	codecs := NewTaskCodecRegistry()
+	require.NoError(t, codecs.Register("persist", TaskInfoCodec(func(info TaskInfo) (WorkerTask, error) {
+		return &persistTask{}, nil
+	})))
+
+	//沒有worker，任務不會執行完畢
+	remote, cancel := NewSyncTaskSystem(10, WithTaskCodecs(codecs))
+	defer cancel()
+	remote.Start()
+	require.NoError(t, remote.ConsumeRemote(broker, "tasks", "worker"))
+
+	publisher, cancelPub := NewSyncTaskSystem(10, WithTaskCodecs(codecs), WithRemotePublisher(broker, "tasks", "persist"))
+	defer cancelPub()
+	publisher.TaskInQueue(&persistTask{Value: "remote"})
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-broker.acked:
+		var requeue *RemoteRequeueError
+		require.True(t, errors.As(err, &requeue))
+		require.True(t, requeue.Requeue())
+	case <-time.After(5 * time.Second):
+		t.Fatal("remote task not returned")
+	}
+}
+
+func TestSyncTaskSystemRemotePublishConfirm(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	codecs := NewTaskCodecRegistry()
+	require.NoError(t, codecs.Register("keyed", TaskInfoCodec(func(info TaskInfo) (WorkerTask, error) {
+		return &keyedTask{key: info.IdempotencyKey}, nil
+	})))
+
+	//broker確認前handle不完成
+	hold := make(chan struct{})
+	broker := &fakeBroker{queue: make(chan []byte, 10), hold: hold}
+	publisher, cancel1 := NewSyncTaskSystem(10, WithTaskCodecs(codecs), WithRemotePublisher(broker, "tasks", "keyed"))
+	defer cancel1()
+	h := publisher.TaskInQueue(&keyedTask{key: "order-6"})[0]
+	select {
+	case <-h.Done():
+		t.Fatal("handle resolved before broker confirmation")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(hold)
+	res, err := h.Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, TaskPublished, res.Code)
+
+	//nack時以TaskFailed完成並釋放去重key
+	nacked := errors.New("nacked")
+	broker = &fakeBroker{queue: make(chan []byte, 10), nack: nacked}
+	publisher, cancel2 := NewSyncTaskSystem(10,
+		WithTaskCodecs(codecs),
+		WithRemotePublisher(broker, "tasks", "keyed"),
+		WithDedup(NewMemoryDedupStore(), time.Minute, DedupDrop),
+	)
+	defer cancel2()
+	res, err = publisher.TaskInQueue(&keyedTask{key: "order-7"})[0].Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, TaskFailed, res.Code)
+	require.ErrorIs(t, res.Error, nacked)
+
+	broker.nack = nil
+	res, err = publisher.TaskInQueue(&keyedTask{key: "order-7"})[0].Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, TaskPublished, res.Code)
+	require.Len(t, broker.queue, 1)
+}
@@ -0,0 +1,177 @@
+package worker
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	LaneCritical = "critical" //延遲敏感任務
+	LaneDefault  = "default"  //一般任務，TaskInQueue預設通道
+	LaneBulk     = "bulk"     //大量批次任務
+)
+
+/*
+優先通道設定
+
+	Name: 通道名稱
+	Weight: 權重，distributor依權重比例從各通道取出任務，<=0 視為1
+	Size: 通道緩衝大小，0表示使用NewSyncTaskSystem的qsize
+*/
+type LaneConfig struct {
+	Name   string
+	Weight int
+	Size   int
+}
+
+// 未指定WithLanes時使用的通道設定
+var DefaultLanes = []LaneConfig{
+	{Name: LaneCritical, Weight: 8},
+	{Name: LaneDefault, Weight: 4},
+	{Name: LaneBulk, Weight: 1},
+}
+
+// 任務可選擇實作LaneTask，TaskInQueue會依GetLane()放入對應通道
+// 通道不存在時放入預設通道
+type LaneTask interface {
+	GetLane() string
+}
+
+type LaneStaticsData struct {
+	Name            string `json:"name"`
+	Weight          int    `json:"weight"`
+	Depth           int    `json:"depth"`
+	Capacity        int    `json:"capacity"`
+	DispatchedCount uint64 `json:"dispatched_count"`
+}
+
+type taskLane struct {
+	name       string
+	weight     int
+	current    int //smooth weighted round robin 目前權重
+	queue      chan WorkerTask
+	dispatched atomic.Uint64
+}
+
+/*
+依權重從多個通道取出任務
+使用smooth weighted round robin，只有非空通道參與選擇
+避免大量bulk任務佔滿distributor，讓critical任務餓死
+*/
+type laneScheduler struct {
+	lanes       []*taskLane
+	byName      map[string]*taskLane
+	defaultLane *taskLane
+	mu          sync.Mutex
+}
+
+func newLaneScheduler(configs []LaneConfig, qsize int) (*laneScheduler, error) {
+	if len(configs) == 0 {
+		configs = DefaultLanes
+	}
+
+	ls := &laneScheduler{
+		byName: make(map[string]*taskLane, len(configs)),
+	}
+	for _, c := range configs {
+		if c.Name == "" {
+			return nil, fmt.Errorf("lane name cannot be empty")
+		}
+		if _, ok := ls.byName[c.Name]; ok {
+			return nil, fmt.Errorf("duplicate lane name: %s", c.Name)
+		}
+		if c.Weight <= 0 {
+			c.Weight = 1
+		}
+		if c.Size <= 0 {
+			c.Size = qsize
+		}
+		lane := &taskLane{
+			name:   c.Name,
+			weight: c.Weight,
+			queue:  make(chan WorkerTask, c.Size),
+		}
+		ls.lanes = append(ls.lanes, lane)
+		ls.byName[c.Name] = lane
+	}
+
+	//有default通道就使用，否則以第一個通道當作預設
+	if lane, ok := ls.byName[LaneDefault]; ok {
+		ls.defaultLane = lane
+	} else {
+		ls.defaultLane = ls.lanes[0]
+	}
+	return ls, nil
+}
+
+func (ls *laneScheduler) getLane(name string) (*taskLane, bool) {
+	lane, ok := ls.byName[name]
+	return lane, ok
+}
+
+// 依任務實作的LaneTask決定通道，沒有實作或通道不存在則回傳預設通道
+func (ls *laneScheduler) laneOf(task WorkerTask) *taskLane {
+	if t, ok := task.(LaneTask); ok {
+		if lane, ok := ls.byName[t.GetLane()]; ok {
+			return lane
+		}
+	}
+	return ls.defaultLane
+}
+
+// 所有通道待處理任務總數
+func (ls *laneScheduler) len() int {
+	total := 0
+	for _, lane := range ls.lanes {
+		total += len(lane.queue)
+	}
+	return total
+}
+
+// 依權重選出下一個非空通道並取出任務，所有通道皆為空時回傳false
+func (ls *laneScheduler) next() (WorkerTask, bool) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	for {
+		var selected *taskLane
+		total := 0
+		for _, lane := range ls.lanes {
+			if len(lane.queue) == 0 {
+				continue
+			}
+			lane.current += lane.weight
+			total += lane.weight
+			if selected == nil || lane.current > selected.current {
+				selected = lane
+			}
+		}
+		if selected == nil {
+			return nil, false
+		}
+		selected.current -= total
+
+		select {
+		case task := <-selected.queue:
+			selected.dispatched.Add(1)
+			return task, true
+		default:
+			//通道在選擇後被其他人取空，重新選擇
+		}
+	}
+}
+
+func (ls *laneScheduler) statics() []LaneStaticsData {
+	res := make([]LaneStaticsData, 0, len(ls.lanes))
+	for _, lane := range ls.lanes {
+		res = append(res, LaneStaticsData{
+			Name:            lane.name,
+			Weight:          lane.weight,
+			Depth:           len(lane.queue),
+			Capacity:        cap(lane.queue),
+			DispatchedCount: lane.dispatched.Load(),
+		})
+	}
+	return res
+}
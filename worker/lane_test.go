@@ -0,0 +1,140 @@
+package worker
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type laneTestTask struct {
+	lane string
+}
+
+func (t *laneTestTask) Excute(context.Context) *TaskResult { return &TaskResult{Code: TaskSuccess} }
+func (t *laneTestTask) HandleResult(*TaskResult)           {}
+func (t *laneTestTask) GetTaskInfo() []byte                { return nil }
+func (t *laneTestTask) GetLane() string                    { return t.lane }
+
+func TestLaneSchedulerWeightedPick(t *testing.T) {
+	ls, err := newLaneScheduler([]LaneConfig{
+		{Name: LaneCritical, Weight: 3},
+		{Name: LaneBulk, Weight: 1},
+	}, 100)
+	require.NoError(t, err)
+
+	for i := 0; i < 40; i++ {
+		ls.laneOf(&laneTestTask{lane: LaneCritical}).queue <- &laneTestTask{lane: LaneCritical}
+		ls.laneOf(&laneTestTask{lane: LaneBulk}).queue <- &laneTestTask{lane: LaneBulk}
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 40; i++ {
+		task, ok := ls.next()
+		require.True(t, ok)
+		counts[task.(*laneTestTask).lane]++
+	}
+	require.Equal(t, 30, counts[LaneCritical])
+	require.Equal(t, 10, counts[LaneBulk])
+
+	//critical清空後，bulk不受權重限制
+	for i := 0; i < 40; i++ {
+		_, ok := ls.next()
+		require.True(t, ok)
+	}
+	_, ok := ls.next()
+	require.False(t, ok)
+}
+
+func TestLaneSchedulerDefaultLane(t *testing.T) {
+	ls, err := newLaneScheduler(nil, 10)
+	require.NoError(t, err)
+	require.Equal(t, LaneDefault, ls.laneOf(&laneTestTask{lane: "unknown"}).name)
+	require.Equal(t, LaneBulk, ls.laneOf(&laneTestTask{lane: LaneBulk}).name)
+
+	_, err = newLaneScheduler([]LaneConfig{{Name: "a"}, {Name: "a"}}, 10)
+	require.Error(t, err)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Info(context.Context, string, ...interface{})  {}
+func (nopLogger) Error(context.Context, string, ...interface{}) {}
+func (nopLogger) Warn(context.Context, string, ...interface{})  {}
+
+// 執行一小段時間並計數的任務
+type laneCountTask struct {
+	lane  string
+	count *atomic.Int64
+}
+
+func (t *laneCountTask) Excute(context.Context) *TaskResult {
+	time.Sleep(100 * time.Microsecond)
+	t.count.Add(1)
+	return &TaskResult{Code: TaskSuccess}
+}
+func (t *laneCountTask) HandleResult(*TaskResult) {}
+func (t *laneCountTask) GetTaskInfo() []byte      { return nil }
+func (t *laneCountTask) GetLane() string          { return t.lane }
+
+func TestSyncTaskSystemCriticalNotStarvedByBulk(t *testing.T) {
+	s, cancel := NewSyncTaskSystem(5000, WithLogger(nopLogger{}))
+	defer cancel()
+	s.AddWorker(NewWorker(WorkerOption{Logger: nopLogger{}}))
+	s.Start()
+
+	var bulk, critical atomic.Int64
+	tasks := make([]WorkerTask, 3000)
+	for i := range tasks {
+		tasks[i] = &laneCountTask{lane: LaneBulk, count: &bulk}
+	}
+	s.TaskInQueue(tasks...)
+	require.Eventually(t, func() bool { return bulk.Load() > 0 }, time.Second, time.Millisecond)
+
+	//bulk已開始執行後才送入critical，仍在少數bulk任務之後執行
+	before := bulk.Load()
+	ctx, done := context.WithTimeout(context.Background(), 5*time.Second)
+	defer done()
+	_, err := s.TaskInQueue(&laneCountTask{lane: LaneCritical, count: &critical})[0].Wait(ctx)
+	require.NoError(t, err)
+	require.Less(t, bulk.Load()-before, int64(3*DefaultPrefetch))
+	require.Less(t, bulk.Load(), int64(len(tasks)))
+}
+
+// FeedTask阻塞直到release關閉
+type blockingFeedWorker struct {
+	stubWorker
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingFeedWorker) FeedTask([]WorkerTask) bool {
+	close(w.entered)
+	<-w.release
+	return false
+}
+
+func TestSyncTaskSystemFeedDoesNotHoldWorkerLock(t *testing.T) {
+	s, cancel := NewSyncTaskSystem(10)
+	defer cancel()
+	blocked := &blockingFeedWorker{entered: make(chan struct{}), release: make(chan struct{})}
+	defer close(blocked.release)
+	s.AddWorker(blocked)
+	s.Start()
+	s.TaskInQueue(&laneTestTask{})
+	<-blocked.entered
+
+	added := make(chan struct{})
+	go func() {
+		s.AddWorker(&stubWorker{})
+		s.RemoveWorker(blocked)
+		close(added)
+	}()
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Fatal("AddWorker blocked by FeedTask")
+	}
+}
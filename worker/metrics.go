@@ -0,0 +1,147 @@
+package worker
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RoyceAzure/rj/util/metrics"
+)
+
+// 單一TaskName的執行統計
+type taskNameMetrics struct {
+	finished atomic.Uint64
+	failed   atomic.Uint64
+	duration *metrics.Histogram
+}
+
+// 依TaskName彙整的任務執行統計
+type taskMetrics struct {
+	byName map[string]*taskNameMetrics
+	mu     sync.RWMutex
+}
+
+func newTaskMetrics() *taskMetrics {
+	return &taskMetrics{
+		byName: make(map[string]*taskNameMetrics),
+	}
+}
+
+func (m *taskMetrics) get(taskName string) *taskNameMetrics {
+	m.mu.RLock()
+	tm, ok := m.byName[taskName]
+	m.mu.RUnlock()
+	if ok {
+		return tm
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if tm, ok = m.byName[taskName]; !ok {
+		tm = &taskNameMetrics{duration: metrics.NewHistogram(nil)}
+		m.byName[taskName] = tm
+	}
+	return tm
+}
+
+// 紀錄一個執行完畢的任務，dur為所有執行次數的總時間
+func (m *taskMetrics) record(taskName string, code TaskResultCode, dur time.Duration) {
+	tm := m.get(taskName)
+	tm.finished.Add(1)
+	if code != TaskSuccess {
+		tm.failed.Add(1)
+	}
+	tm.duration.Observe(dur.Seconds())
+}
+
+func (m *taskMetrics) names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.byName))
+	for name := range m.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var workerStatusNames = []struct {
+	status WorkerStatus
+	name   string
+}{
+	{Running, "running"},
+	{Idle, "idle"},
+	{Stop, "stop"},
+}
+
+// 將系統、通道、worker與各TaskName的統計以Prometheus指標寫出
+func (s *SyncTaskSystem) Collect(w *metrics.Writer) {
+	lanes := s.lanes.statics()
+	for _, lane := range lanes {
+		w.Gauge("rj_worker_queue_depth", "Number of tasks waiting in lane.", float64(lane.Depth), metrics.L("lane", lane.Name))
+	}
+	for _, lane := range lanes {
+		w.Counter("rj_worker_lane_dispatched_total", "Number of tasks dispatched from lane to workers.", float64(lane.DispatchedCount), metrics.L("lane", lane.Name))
+	}
+	w.Gauge("rj_worker_tasks_outstanding", "Number of accepted tasks not yet finished.", float64(s.outstanding()))
+	w.Counter("rj_worker_tasks_suppressed_total", "Number of duplicate tasks suppressed by idempotency key.", float64(s.suppressed.Load()))
+	w.Counter("rj_worker_results_dropped_total", "Number of task results dropped because the result queue was full.", float64(s.droppedRes.Load()))
+
+	names := s.metrics.names()
+	for _, name := range names {
+		w.Counter("rj_worker_tasks_finished_total", "Number of finished tasks.", float64(s.metrics.get(name).finished.Load()), metrics.L("task_name", name))
+	}
+	for _, name := range names {
+		w.Counter("rj_worker_tasks_failed_total", "Number of finished tasks whose result is not success.", float64(s.metrics.get(name).failed.Load()), metrics.L("task_name", name))
+	}
+	for _, name := range names {
+		w.Histogram("rj_worker_task_duration_seconds", "Task execution time including retries.", s.metrics.get(name).duration.Snapshot(), metrics.L("task_name", name))
+	}
+
+	workers := s.GetWorkers()
+	stats := make([]WorkerStaticsData, len(workers))
+	ids := make([]string, len(workers))
+	for i, wk := range workers {
+		stats[i] = wk.GetStatusData()
+		ids[i] = workerId(wk, i)
+	}
+	for i, st := range stats {
+		for _, sn := range workerStatusNames {
+			value := 0.0
+			if st.Status == sn.status {
+				value = 1
+			}
+			w.Gauge("rj_worker_status", "Current worker status, 1 for the active status.", value, metrics.L("worker", ids[i]), metrics.L("status", sn.name))
+		}
+	}
+	for i, st := range stats {
+		w.Gauge("rj_worker_current_tasks", "Number of tasks assigned to worker and not yet finished.", float64(st.CurrentTaskCount), metrics.L("worker", ids[i]))
+	}
+	for i, st := range stats {
+		w.Counter("rj_worker_finished_jobs_total", "Number of tasks finished by worker.", float64(st.FinishedJobCount), metrics.L("worker", ids[i]))
+	}
+	for i, st := range stats {
+		w.Counter("rj_worker_throttled_wait_seconds_total", "Time tasks spent waiting on rate limits before execution.", st.ThrottledWaitTime.Seconds(), metrics.L("worker", ids[i]))
+	}
+	for i, st := range stats {
+		w.Gauge("rj_worker_average_execution_seconds", "Average task execution time of worker.", st.AverageExecutionTime.Seconds(), metrics.L("worker", ids[i]))
+	}
+}
+
+// 回傳輸出系統指標的http.Handler
+func (s *SyncTaskSystem) MetricsHandler() http.Handler {
+	return metrics.Handler(s)
+}
+
+// *Worker使用Id，其他IWoker實作以index代替
+func workerId(w IWoker, idx int) string {
+	if wk, ok := w.(*Worker); ok {
+		return wk.Id.String()
+	}
+	return strconv.Itoa(idx)
+}
+
+var _ metrics.Collector = (*SyncTaskSystem)(nil)
@@ -0,0 +1,38 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncTaskSystemMetricsHandler(t *testing.T) {
+	s, cancel := NewSyncTaskSystem(10)
+	defer cancel()
+	s.AddWorker(NewWorker(WorkerOption{}))
+	s.Start()
+
+	ok := &flakyTask{done: make(chan *TaskResult, 1)}
+	failed := &flakyTask{failTimes: 1, err: errors.New("boom"), done: make(chan *TaskResult, 1)}
+	handles := s.TaskInQueue(ok, failed)
+	ctx, done := context.WithTimeout(context.Background(), 5*time.Second)
+	defer done()
+	for _, h := range handles {
+		_, err := h.Wait(ctx)
+		require.NoError(t, err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	require.Contains(t, body, `rj_worker_queue_depth{lane="bulk"} 0`)
+	require.Contains(t, body, `rj_worker_tasks_finished_total{task_name="flaky"} 2`)
+	require.Contains(t, body, `rj_worker_tasks_failed_total{task_name="flaky"} 1`)
+	require.Contains(t, body, `rj_worker_task_duration_seconds_count{task_name="flaky"} 2`)
+	require.Contains(t, body, "# TYPE rj_worker_status gauge")
+}
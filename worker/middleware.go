@@ -0,0 +1,199 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/RoyceAzure/rj/util/rj_error"
+)
+
+var ErrTaskPanic = errors.New("task panic")
+
+// 執行任務並回傳結果
+type Handler func(ctx context.Context, task WorkerTask) *TaskResult
+
+/*
+包裝Handler，用於追蹤、稽核、統計等橫切行為
+先註冊的middleware在外層
+*/
+type Middleware func(next Handler) Handler
+
+/*
+任務生命週期hook，未設定的欄位不會呼叫
+hook在執行任務的goroutine中同步呼叫，不應阻塞
+
+	OnEnqueue: 任務被接收時
+	OnStart: 任務開始執行前
+	OnSuccess: 任務執行成功後
+	OnFailure: 任務執行結果不是成功時，包含panic
+	OnPanic: 任務panic時，recovered為recover()的值
+*/
+type TaskHooks struct {
+	OnEnqueue func(ctx context.Context, task WorkerTask)
+	OnStart   func(ctx context.Context, task WorkerTask)
+	OnSuccess func(ctx context.Context, task WorkerTask, res *TaskResult)
+	OnFailure func(ctx context.Context, task WorkerTask, res *TaskResult)
+	OnPanic   func(ctx context.Context, task WorkerTask, recovered any)
+}
+
+/*
+panic recovery middleware，將panic轉為TaskFailed結果
+Error包裝ErrTaskPanic，內容為rj_error.GetRecoverMsg的訊息與stack
+
+	onPanic: 可為nil，panic時呼叫
+*/
+func Recovery(onPanic func(ctx context.Context, task WorkerTask, recovered any)) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, task WorkerTask) (res *TaskResult) {
+			defer func() {
+				if r := recover(); r != nil {
+					if onPanic != nil {
+						onPanic(ctx, task, r)
+					}
+					res = panicResult(r)
+				}
+			}()
+			return next(ctx, task)
+		}
+	}
+}
+
+func panicResult(recovered any) *TaskResult {
+	return &TaskResult{
+		Code:  TaskFailed,
+		Error: fmt.Errorf("%w: %s", ErrTaskPanic, rj_error.GetRecoverMsg(recovered)),
+	}
+}
+
+/*
+Worker與SyncTaskSystem共用的middleware與hook
+執行順序: hooks -> Recovery -> 註冊的middleware -> 任務
+*/
+type taskPipeline struct {
+	middlewares []Middleware
+	hooks       []TaskHooks
+	mu          sync.RWMutex
+}
+
+func newTaskPipeline() *taskPipeline {
+	return &taskPipeline{}
+}
+
+func (p *taskPipeline) use(mws ...Middleware) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.middlewares = append(p.middlewares, mws...)
+}
+
+func (p *taskPipeline) addHooks(hooks TaskHooks) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hooks = append(p.hooks, hooks)
+}
+
+// 以目前註冊的middleware與Recovery包裝base，不含hook
+func (p *taskPipeline) chain(base Handler) Handler {
+	p.mu.RLock()
+	mws := p.middlewares
+	p.mu.RUnlock()
+
+	h := base
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return Recovery(p.panic)(h)
+}
+
+// 以目前註冊的middleware與hook包裝base
+func (p *taskPipeline) handler(base Handler) Handler {
+	h := p.chain(base)
+	return func(ctx context.Context, task WorkerTask) *TaskResult {
+		p.start(ctx, task)
+		res := h(ctx, task)
+		if res == nil {
+			res = &TaskResult{Code: TaskFailed, Error: fmt.Errorf("task returned nil result")}
+		}
+		if res.Code == TaskSuccess {
+			p.success(ctx, task, res)
+		} else {
+			p.failure(ctx, task, res)
+		}
+		return res
+	}
+}
+
+func (p *taskPipeline) snapshot() []TaskHooks {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.hooks
+}
+
+func (p *taskPipeline) enqueue(ctx context.Context, task WorkerTask) {
+	for _, h := range p.snapshot() {
+		if h.OnEnqueue != nil {
+			h.OnEnqueue(ctx, task)
+		}
+	}
+}
+
+func (p *taskPipeline) start(ctx context.Context, task WorkerTask) {
+	for _, h := range p.snapshot() {
+		if h.OnStart != nil {
+			h.OnStart(ctx, task)
+		}
+	}
+}
+
+func (p *taskPipeline) success(ctx context.Context, task WorkerTask, res *TaskResult) {
+	for _, h := range p.snapshot() {
+		if h.OnSuccess != nil {
+			h.OnSuccess(ctx, task, res)
+		}
+	}
+}
+
+func (p *taskPipeline) failure(ctx context.Context, task WorkerTask, res *TaskResult) {
+	for _, h := range p.snapshot() {
+		if h.OnFailure != nil {
+			h.OnFailure(ctx, task, res)
+		}
+	}
+}
+
+func (p *taskPipeline) panic(ctx context.Context, task WorkerTask, recovered any) {
+	for _, h := range p.snapshot() {
+		if h.OnPanic != nil {
+			h.OnPanic(ctx, task, recovered)
+		}
+	}
+}
+
+/*
+將在其他goroutine recover的panic重新經過middleware與Recovery
+讓註冊的Recovery middleware與OnPanic hook得知panic，不呼叫OnStart等其他hook，結果捨棄
+*/
+func (p *taskPipeline) replayPanic(ctx context.Context, task WorkerTask, recovered any) {
+	p.chain(func(context.Context, WorkerTask) *TaskResult {
+		panic(recovered)
+	})(ctx, task)
+}
+
+type pipelineCtxKey struct{}
+
+// 記錄正在執行任務的worker pipeline
+func withPipeline(ctx context.Context, p *taskPipeline) context.Context {
+	return context.WithValue(ctx, pipelineCtxKey{}, p)
+}
+
+// 取得正在執行任務的worker pipeline，不在worker中執行時回傳nil
+func pipelineFrom(ctx context.Context) *taskPipeline {
+	p, _ := ctx.Value(pipelineCtxKey{}).(*taskPipeline)
+	return p
+}
+
+// 直接執行任務的Handler
+func excuteTask(ctx context.Context, task WorkerTask) *TaskResult {
+	return task.Excute(ctx)
+}
@@ -0,0 +1,150 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type panicTask struct {
+	done chan *TaskResult
+}
+
+func (t *panicTask) Excute(context.Context) *TaskResult { panic("boom") }
+func (t *panicTask) HandleResult(res *TaskResult)       { t.done <- res }
+func (t *panicTask) GetTaskInfo() []byte                { return []byte(`{"task_name":"panic"}`) }
+
+func TestWorkerMiddlewareAndRecovery(t *testing.T) {
+	w := NewWorker(WorkerOption{})
+	var mu sync.Mutex
+	var events []string
+	record := func(e string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	}
+	w.Use(func(next Handler) Handler {
+		return func(ctx context.Context, task WorkerTask) *TaskResult {
+			record("outer")
+			return next(ctx, task)
+		}
+	}, func(next Handler) Handler {
+		return func(ctx context.Context, task WorkerTask) *TaskResult {
+			record("inner")
+			return next(ctx, task)
+		}
+	})
+	w.AddHooks(TaskHooks{
+		OnEnqueue: func(context.Context, WorkerTask) { record("enqueue") },
+		OnStart:   func(context.Context, WorkerTask) { record("start") },
+		OnSuccess: func(context.Context, WorkerTask, *TaskResult) { record("success") },
+		OnFailure: func(context.Context, WorkerTask, *TaskResult) { record("failure") },
+		OnPanic:   func(context.Context, WorkerTask, any) { record("panic") },
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w.Run(ctx)
+
+	task := &panicTask{done: make(chan *TaskResult, 1)}
+	w.FeedTask([]WorkerTask{task})
+	select {
+	case res := <-task.done:
+		require.Equal(t, TaskFailed, res.Code)
+		require.True(t, errors.Is(res.Error, ErrTaskPanic))
+		require.Contains(t, res.Error.Error(), "boom")
+	case <-time.After(5 * time.Second):
+		t.Fatal("panic task not handled")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []string{"enqueue", "start", "outer", "inner", "panic", "failure"}, events)
+	require.EqualValues(t, 1, w.GetStatusData().FinishedJobCount)
+}
+
+func TestSyncTaskSystemHooks(t *testing.T) {
+	s, cancel := NewSyncTaskSystem(10)
+	defer cancel()
+
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	record := func(e string) {
+		mu.Lock()
+		defer mu.Unlock()
+		counts[e]++
+	}
+	s.AddHooks(TaskHooks{
+		OnEnqueue: func(context.Context, WorkerTask) { record("enqueue") },
+		OnSuccess: func(context.Context, WorkerTask, *TaskResult) { record("success") },
+		OnFailure: func(context.Context, WorkerTask, *TaskResult) { record("failure") },
+		OnPanic:   func(context.Context, WorkerTask, any) { record("panic") },
+	})
+	s.AddWorker(NewWorker(WorkerOption{}))
+	s.Start()
+
+	handles := s.TaskInQueue(&valueTask{value: 1}, &panicTask{done: make(chan *TaskResult, 1)})
+	ctx, cancelWait := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelWait()
+	for _, h := range handles {
+		_, err := h.Wait(ctx)
+		require.NoError(t, err)
+	}
+	require.True(t, errors.Is(handles[1].Result().Error, ErrTaskPanic))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, map[string]int{"enqueue": 2, "success": 1, "failure": 1, "panic": 1}, counts)
+}
+
+func TestSyncTaskSystemPanicReachesWorker(t *testing.T) {
+	ctx, cancelWait := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelWait()
+
+	hooked := make(chan any, 1)
+	w := NewWorker(WorkerOption{})
+	w.AddHooks(TaskHooks{
+		OnPanic: func(_ context.Context, task WorkerTask, recovered any) {
+			_, ok := task.(*panicTask)
+			require.True(t, ok)
+			hooked <- recovered
+		},
+	})
+	s, cancel := NewSyncTaskSystem(10)
+	defer cancel()
+	s.AddWorker(w)
+	s.Start()
+
+	res, err := s.TaskInQueue(&panicTask{done: make(chan *TaskResult, 1)})[0].Wait(ctx)
+	require.NoError(t, err)
+	require.True(t, errors.Is(res.Error, ErrTaskPanic))
+	select {
+	case r := <-hooked:
+		require.Equal(t, "boom", r)
+	default:
+		t.Fatal("worker OnPanic not called")
+	}
+
+	//worker註冊的Recovery middleware也會收到panic
+	recovered := make(chan any, 1)
+	w2 := NewWorker(WorkerOption{})
+	w2.Use(Recovery(func(_ context.Context, _ WorkerTask, r any) { recovered <- r }))
+	s2, cancel2 := NewSyncTaskSystem(10)
+	defer cancel2()
+	s2.AddWorker(w2)
+	s2.Start()
+
+	res, err = s2.TaskInQueue(&panicTask{done: make(chan *TaskResult, 1)})[0].Wait(ctx)
+	require.NoError(t, err)
+	require.True(t, errors.Is(res.Error, ErrTaskPanic))
+	select {
+	case r := <-recovered:
+		require.Equal(t, "boom", r)
+	default:
+		t.Fatal("worker Recovery middleware not called")
+	}
+}
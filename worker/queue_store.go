@@ -0,0 +1,309 @@
+package worker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 永久儲存中的一筆待處理任務
+type QueueRecord struct {
+	Id         string    `json:"id"`
+	Lane       string    `json:"lane"`
+	TaskName   string    `json:"task_name"`
+	Payload    []byte    `json:"payload"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+}
+
+/*
+任務佇列永久儲存
+任務進入系統時Append，HandleResult完成後Ack
+系統Start時會將Pending的任務重新放入通道
+*/
+type TaskQueueStore interface {
+	Append(rec QueueRecord) error
+	Ack(id string) error
+	Pending() ([]QueueRecord, error)
+	Close() error
+}
+
+// 存放在記憶體的TaskQueueStore，用於測試
+type MemoryQueueStore struct {
+	order   []string
+	records map[string]QueueRecord
+	mu      sync.Mutex
+}
+
+func NewMemoryQueueStore() *MemoryQueueStore {
+	return &MemoryQueueStore{
+		records: make(map[string]QueueRecord),
+	}
+}
+
+func (m *MemoryQueueStore) Append(rec QueueRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.records[rec.Id]; !ok {
+		m.order = append(m.order, rec.Id)
+	}
+	m.records[rec.Id] = rec
+	return nil
+}
+
+func (m *MemoryQueueStore) Ack(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, id)
+	return nil
+}
+
+func (m *MemoryQueueStore) Pending() ([]QueueRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]QueueRecord, 0, len(m.records))
+	order := m.order[:0]
+	for _, id := range m.order {
+		rec, ok := m.records[id]
+		if !ok {
+			continue
+		}
+		order = append(order, id)
+		res = append(res, rec)
+	}
+	m.order = order
+	return res, nil
+}
+
+func (m *MemoryQueueStore) Close() error {
+	return nil
+}
+
+const (
+	queueOpAppend = "append"
+	queueOpAck    = "ack"
+
+	//已ack紀錄超過此數量且多於待處理數時壓縮檔案
+	compactThreshold = 1000
+)
+
+type queueLogEntry struct {
+	Op     string       `json:"op"`
+	Id     string       `json:"id,omitempty"`
+	Record *QueueRecord `json:"record,omitempty"`
+}
+
+/*
+以append-only檔案實作的TaskQueueStore
+每行一筆json操作紀錄(append/ack)，開啟時重播紀錄還原待處理任務並壓縮檔案
+*/
+type FileQueueStore struct {
+	path      string
+	file      *os.File
+	syncWrite bool
+	order     []string
+	records   map[string]QueueRecord
+	acked     int
+	mu        sync.Mutex
+}
+
+/*
+@parm
+
+	path: 檔案路徑，不存在時建立
+	syncWrite: 每次寫入後是否fsync，關閉可提升效能但程序異常結束時可能遺失最後幾筆
+*/
+func NewFileQueueStore(path string, syncWrite bool) (*FileQueueStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create queue store dir failed: %w", err)
+	}
+
+	f := &FileQueueStore{
+		path:      path,
+		syncWrite: syncWrite,
+		records:   make(map[string]QueueRecord),
+	}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	if err := f.compact(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+/*
+重播檔案中的操作紀錄
+只有最後一行不完整(寫入中斷)時忽略，其他行無法解析時回傳錯誤，避免遺失之後的紀錄
+*/
+func (f *FileQueueStore) load() error {
+	file, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open queue store failed: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	var corrupted error
+	line := 0
+	for scanner.Scan() {
+		line++
+		if corrupted != nil {
+			return corrupted
+		}
+		var entry queueLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			corrupted = fmt.Errorf("queue store %s corrupted at line %d: %w", f.path, line, err)
+			continue
+		}
+		switch entry.Op {
+		case queueOpAppend:
+			if entry.Record == nil {
+				continue
+			}
+			if _, ok := f.records[entry.Record.Id]; !ok {
+				f.order = append(f.order, entry.Record.Id)
+			}
+			f.records[entry.Record.Id] = *entry.Record
+		case queueOpAck:
+			delete(f.records, entry.Id)
+		}
+	}
+	return scanner.Err()
+}
+
+// 只保留待處理任務重寫檔案，寫入暫存檔後rename避免中途失敗毀損原檔
+// 呼叫端需持有mu，或在尚未對外提供時呼叫
+func (f *FileQueueStore) compact() error {
+	tmpPath := f.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("create compact file failed: %w", err)
+	}
+
+	w := bufio.NewWriter(tmp)
+	order := f.order[:0]
+	for _, id := range f.order {
+		rec, ok := f.records[id]
+		if !ok {
+			continue
+		}
+		order = append(order, id)
+		b, err := json.Marshal(queueLogEntry{Op: queueOpAppend, Record: &rec})
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		w.Write(append(b, '\n'))
+	}
+	f.order = order
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write compact file failed: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+
+	if f.file != nil {
+		f.file.Close()
+	}
+	if err := os.Rename(tmpPath, f.path); err != nil {
+		return fmt.Errorf("replace queue store file failed: %w", err)
+	}
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open queue store failed: %w", err)
+	}
+	f.file = file
+	f.acked = 0
+	return nil
+}
+
+// 呼叫端需持有mu
+func (f *FileQueueStore) write(entry queueLogEntry) error {
+	if f.file == nil {
+		return fmt.Errorf("queue store is closed")
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := f.file.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("write queue store failed: %w", err)
+	}
+	if f.syncWrite {
+		return f.file.Sync()
+	}
+	return nil
+}
+
+func (f *FileQueueStore) Append(rec QueueRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.write(queueLogEntry{Op: queueOpAppend, Record: &rec}); err != nil {
+		return err
+	}
+	if _, ok := f.records[rec.Id]; !ok {
+		f.order = append(f.order, rec.Id)
+	}
+	f.records[rec.Id] = rec
+	return nil
+}
+
+func (f *FileQueueStore) Ack(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.records[id]; !ok {
+		return nil
+	}
+	if err := f.write(queueLogEntry{Op: queueOpAck, Id: id}); err != nil {
+		return err
+	}
+	delete(f.records, id)
+	f.acked++
+
+	if f.acked > compactThreshold && f.acked > len(f.records) {
+		return f.compact()
+	}
+	return nil
+}
+
+func (f *FileQueueStore) Pending() ([]QueueRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	res := make([]QueueRecord, 0, len(f.records))
+	for _, id := range f.order {
+		if rec, ok := f.records[id]; ok {
+			res = append(res, rec)
+		}
+	}
+	return res, nil
+}
+
+func (f *FileQueueStore) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+var (
+	_ TaskQueueStore = (*MemoryQueueStore)(nil)
+	_ TaskQueueStore = (*FileQueueStore)(nil)
+)
@@ -0,0 +1,118 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type persistTask struct {
+	Value string
+	done  chan string
+}
+
+func (t *persistTask) Excute(context.Context) *TaskResult {
+	return &TaskResult{Code: TaskSuccess, Response: t.Value}
+}
+func (t *persistTask) HandleResult(*TaskResult) {
+	if t.done != nil {
+		t.done <- t.Value
+	}
+}
+func (t *persistTask) GetTaskInfo() []byte {
+	metadata, _ := json.Marshal(t.Value)
+	b, _ := json.Marshal(TaskInfo{
+		BaseTaskInfo: BaseTaskInfo{TaskName: "persist"},
+		Metadata:     metadata,
+	})
+	return b
+}
+
+func TestFileQueueStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue", "tasks.log")
+	store, err := NewFileQueueStore(path, true)
+	require.NoError(t, err)
+
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(t, store.Append(QueueRecord{Id: id, Lane: LaneDefault, TaskName: "persist", Payload: []byte(id)}))
+	}
+	require.NoError(t, store.Ack("b"))
+	require.NoError(t, store.Close())
+
+	store, err = NewFileQueueStore(path, true)
+	require.NoError(t, err)
+	defer store.Close()
+
+	pending, err := store.Pending()
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	require.Equal(t, "a", pending[0].Id)
+	require.Equal(t, []byte("a"), pending[0].Payload)
+	require.Equal(t, "c", pending[1].Id)
+}
+
+func TestFileQueueStoreCorruptedLine(t *testing.T) {
+	dir := t.TempDir()
+	valid := `{"op":"append","record":{"id":"a","lane":"default","task_name":"persist"}}`
+
+	//最後一行寫入中斷時忽略
+	path := filepath.Join(dir, "trailing.log")
+	require.NoError(t, os.WriteFile(path, []byte(valid+"\n"+`{"op":"app`), 0o644))
+	store, err := NewFileQueueStore(path, true)
+	require.NoError(t, err)
+	pending, err := store.Pending()
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	require.NoError(t, store.Close())
+
+	//中間的行毀損時回傳錯誤
+	path = filepath.Join(dir, "middle.log")
+	require.NoError(t, os.WriteFile(path, []byte(`{"op":"app`+"\n"+valid+"\n"), 0o644))
+	_, err = NewFileQueueStore(path, true)
+	require.ErrorContains(t, err, "corrupted at line 1")
+}
+
+func TestSyncTaskSystemReplayPendingTasks(t *testing.T) {
+	store := NewMemoryQueueStore()
+	done := make(chan string, 2)
+	codecs := NewTaskCodecRegistry()
+	require.NoError(t, codecs.Register("persist", TaskInfoCodec(func(info TaskInfo) (WorkerTask, error) {
+		task := &persistTask{done: done}
+		return task, json.Unmarshal(info.Metadata, &task.Value)
+	})))
+
+	//第一個系統沒有worker，任務只會寫入儲存
+	s1, cancel1 := NewSyncTaskSystem(10, WithQueueStore(store, codecs))
+	s1.TaskInQueue(&persistTask{Value: "first"}, &persistTask{Value: "second"})
+	cancel1()
+
+	pending, err := store.Pending()
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+
+	s2, cancel2 := NewSyncTaskSystem(10, WithQueueStore(store, codecs))
+	defer cancel2()
+	s2.AddWorker(NewWorker(WorkerOption{}))
+	s2.Start()
+
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case v := <-done:
+			got[v] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("replayed task not executed")
+		}
+	}
+	require.True(t, got["first"] && got["second"])
+
+	require.Eventually(t, func() bool {
+		pending, _ := store.Pending()
+		return len(pending) == 0
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,174 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/*
+單一TaskName的執行限制
+
+	Rate: 每秒可開始執行的任務數(token bucket)，<=0 表示不限制
+	Burst: token bucket 容量，<=0 視為1
+	MaxInFlight: 同時執行中的任務上限，<=0 表示不限制
+*/
+type RateLimit struct {
+	Rate        float64
+	Burst       int
+	MaxInFlight int
+}
+
+type taskLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	slots  chan struct{} //MaxInFlight > 0 時使用
+	mu     sync.Mutex
+}
+
+func newTaskLimiter(limit RateLimit) *taskLimiter {
+	burst := float64(limit.Burst)
+	if burst <= 0 {
+		burst = 1
+	}
+	l := &taskLimiter{
+		rate:   limit.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+	if limit.MaxInFlight > 0 {
+		l.slots = make(chan struct{}, limit.MaxInFlight)
+	}
+	return l
+}
+
+// 無法取得執行中名額時，任務延後重新分配的時間
+const inFlightRetryInterval = 10 * time.Millisecond
+
+// 呼叫端需持有mu
+func (l *taskLimiter) refill() {
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+}
+
+// 有token時取用並回傳0，否則不取用並回傳距離下一個token的時間
+func (l *taskLimiter) take() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// 預約一個token，回傳需等待的時間
+func (l *taskLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// 取消預約時歸還token
+func (l *taskLimiter) unreserve() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens++
+}
+
+/*
+不等待，嘗試取得執行中名額與一個token
+
+	return:
+		release: 任務執行完畢後呼叫，歸還執行中名額
+		retryAfter: 無法執行時，建議延後的時間
+		ok: false 表示目前不可執行
+*/
+func (l *taskLimiter) tryAcquire() (func(), time.Duration, bool) {
+	release := func() {}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+			release = func() { <-l.slots }
+		default:
+			return nil, inFlightRetryInterval, false
+		}
+	}
+	if l.rate > 0 {
+		if wait := l.take(); wait > 0 {
+			release()
+			return nil, wait, false
+		}
+	}
+	return release, 0, true
+}
+
+// 等待一個token，用於重試時的每次執行，ctx結束時歸還token並回傳ctx.Err()
+func (l *taskLimiter) waitToken(ctx context.Context) error {
+	if l.rate <= 0 {
+		return nil
+	}
+	wait := l.reserve()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.unreserve()
+		return ctx.Err()
+	}
+}
+
+/*
+worker執行任務前檢查是否可執行
+由systemTask實作，讓系統層級的限制在worker執行前生效
+不可執行時任務延後重新放入通道，worker不等待，繼續處理其他任務
+*/
+type admissionTask interface {
+	admit() (release func(), retryAfter time.Duration, ok bool)
+	deferRun(after time.Duration)
+}
+
+// 取得第一次執行的名額與token，重試的token在run中取得
+func (t *systemTask) admit() (func(), time.Duration, bool) {
+	limiter, ok := t.system.limiters[t.name]
+	if !ok {
+		return func() {}, 0, true
+	}
+	return limiter.tryAcquire()
+}
+
+// 經過after後將任務放回原通道
+func (t *systemTask) deferRun(after time.Duration) {
+	time.AfterFunc(after, func() {
+		t.system.enqueue(t)
+	})
+}
+
+// 重試前等待token，沒有設定限制時直接回傳
+func (t *systemTask) waitRetryToken(ctx context.Context) error {
+	limiter, ok := t.system.limiters[t.name]
+	if !ok {
+		return nil
+	}
+	return limiter.waitToken(ctx)
+}
+
+var _ admissionTask = (*systemTask)(nil)
@@ -0,0 +1,84 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskLimiterBurstAndInFlight(t *testing.T) {
+	l := newTaskLimiter(RateLimit{Rate: 10, Burst: 3})
+	for i := 0; i < 3; i++ {
+		_, _, ok := l.tryAcquire()
+		require.True(t, ok)
+	}
+	_, retryAfter, ok := l.tryAcquire()
+	require.False(t, ok)
+	require.Greater(t, retryAfter, time.Duration(0))
+	require.LessOrEqual(t, retryAfter, 100*time.Millisecond)
+
+	l = newTaskLimiter(RateLimit{MaxInFlight: 1})
+	release, _, ok := l.tryAcquire()
+	require.True(t, ok)
+	_, retryAfter, ok = l.tryAcquire()
+	require.False(t, ok)
+	require.Equal(t, inFlightRetryInterval, retryAfter)
+	release()
+	_, _, ok = l.tryAcquire()
+	require.True(t, ok)
+}
+
+func TestSyncTaskSystemRateLimitThroughput(t *testing.T) {
+	s, cancel := NewSyncTaskSystem(20, WithTaskRateLimit("limited", RateLimit{Rate: 20, Burst: 1}))
+	defer cancel()
+	w := NewWorker(WorkerOption{})
+	s.AddWorker(w)
+	s.Start()
+
+	ctx, done := context.WithTimeout(context.Background(), 5*time.Second)
+	defer done()
+
+	start := time.Now()
+	limited := make([]WorkerTask, 6)
+	for i := range limited {
+		limited[i] = &namedTask{name: "limited"}
+	}
+	handles := s.TaskInQueue(limited...)
+
+	//受限任務延後時worker不等待，其他任務可先執行
+	_, err := s.TaskInQueue(&namedTask{name: "free"})[0].Wait(ctx)
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), 150*time.Millisecond)
+
+	for _, h := range handles {
+		res, err := h.Wait(ctx)
+		require.NoError(t, err)
+		require.Equal(t, TaskSuccess, res.Code)
+	}
+	//第1個使用burst，其餘每50ms一個
+	require.GreaterOrEqual(t, time.Since(start), 240*time.Millisecond)
+	require.NotZero(t, w.GetStatusData().ThrottledCount)
+}
+
+func TestSyncTaskSystemRateLimitRetry(t *testing.T) {
+	s, cancel := NewSyncTaskSystem(10,
+		WithTaskRateLimit("flaky", RateLimit{Rate: 10, Burst: 1}),
+		WithRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}),
+	)
+	defer cancel()
+	s.AddWorker(NewWorker(WorkerOption{}))
+	s.Start()
+
+	start := time.Now()
+	task := &flakyTask{failTimes: 2, err: errors.New("temporary"), done: make(chan *TaskResult, 1)}
+	s.TaskInQueue(task)
+	res := <-task.done
+	require.Equal(t, TaskSuccess, res.Code)
+	require.EqualValues(t, 3, task.calls.Load())
+
+	//每次重試各需一個token，間隔100ms
+	require.GreaterOrEqual(t, time.Since(start), 190*time.Millisecond)
+}
@@ -0,0 +1,185 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+/*
+TaskInQueue 回傳的任務handle，可用來等待單一任務的結果
+任務的HandleResult執行完畢後才會完成
+*/
+type TaskHandle struct {
+	Id       string
+	TaskName string
+	done     chan struct{}
+	once     sync.Once
+	result   *TaskResult
+	ctx      context.Context //Cancel時結束，用來中斷任務執行
+	cancel   context.CancelFunc
+}
+
+func newTaskHandle(taskName string) *TaskHandle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &TaskHandle{
+		Id:       uuid.New().String(),
+		TaskName: taskName,
+		done:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+/*
+取消任務
+尚未執行的任務不會執行，執行中的任務ctx會被取消
+結果的Code為TaskCanceled
+*/
+func (h *TaskHandle) Cancel() {
+	h.cancel()
+}
+
+func (h *TaskHandle) resolve(res *TaskResult) {
+	h.once.Do(func() {
+		h.result = res
+		close(h.done)
+	})
+}
+
+// 任務完成時關閉
+func (h *TaskHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+// 回傳任務結果，尚未完成時回傳nil
+func (h *TaskHandle) Result() *TaskResult {
+	select {
+	case <-h.done:
+		return h.result
+	default:
+		return nil
+	}
+}
+
+// 等待任務完成，ctx結束時回傳ctx.Err()
+func (h *TaskHandle) Wait(ctx context.Context) (*TaskResult, error) {
+	select {
+	case <-h.done:
+		return h.result, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// 回傳true的結果才會送給訂閱者
+type ResultFilter func(*TaskResult) bool
+
+/*
+任務結果訂閱
+訂閱者buffer已滿時結果會被丟棄並計入Dropped，避免慢的訂閱者卡住worker
+*/
+type ResultSubscription struct {
+	id      uint64
+	ch      chan *TaskResult
+	filter  ResultFilter
+	dropped atomic.Uint64
+	system  *SyncTaskSystem
+	once    sync.Once
+}
+
+// 接收任務結果，Unsubscribe後關閉
+func (sub *ResultSubscription) C() <-chan *TaskResult {
+	return sub.ch
+}
+
+// 因buffer已滿而丟棄的結果數
+func (sub *ResultSubscription) Dropped() uint64 {
+	return sub.dropped.Load()
+}
+
+func (sub *ResultSubscription) Unsubscribe() {
+	sub.once.Do(func() {
+		sub.system.subMu.Lock()
+		delete(sub.system.subscribers, sub.id)
+		sub.system.subMu.Unlock()
+		close(sub.ch)
+	})
+}
+
+/*
+訂閱任務結果
+
+	bufSize: 訂閱者buffer大小
+	filter: nil 表示訂閱所有結果
+*/
+func (s *SyncTaskSystem) SubscribeResults(bufSize int, filter ResultFilter) *ResultSubscription {
+	sub := &ResultSubscription{
+		ch:     make(chan *TaskResult, bufSize),
+		filter: filter,
+		system: s,
+	}
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	s.subSeq++
+	sub.id = s.subSeq
+	s.subscribers[sub.id] = sub
+	return sub
+}
+
+// 訂閱指定TaskName的任務結果
+func (s *SyncTaskSystem) SubscribeTaskName(taskName string, bufSize int) *ResultSubscription {
+	return s.SubscribeResults(bufSize, func(res *TaskResult) bool {
+		return res.TaskName == taskName
+	})
+}
+
+// 將結果送入resultQueue，已滿時丟棄並計入DroppedResults，不阻塞worker
+func (s *SyncTaskSystem) publishResult(res *TaskResult) {
+	select {
+	case s.resultQueue <- res:
+	default:
+		s.droppedRes.Add(1)
+	}
+}
+
+/*
+used go routine inside
+
+從resultQueue取出結果分送給訂閱者
+*/
+func (s *SyncTaskSystem) dispatchResults() {
+	go func() {
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case res := <-s.resultQueue:
+				s.subMu.RLock()
+				for _, sub := range s.subscribers {
+					if sub.filter != nil && !sub.filter(res) {
+						continue
+					}
+					select {
+					case sub.ch <- res:
+					default:
+						sub.dropped.Add(1)
+					}
+				}
+				s.subMu.RUnlock()
+			}
+		}
+	}()
+}
+
+// 從GetTaskInfo()解析TaskName，無法解析時回傳空字串
+func taskNameOf(task WorkerTask) string {
+	var info BaseTaskInfo
+	if err := json.Unmarshal(task.GetTaskInfo(), &info); err != nil {
+		return ""
+	}
+	return info.TaskName
+}
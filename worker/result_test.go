@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type namedTask struct {
+	name string
+	err  error
+}
+
+func (t *namedTask) Excute(context.Context) *TaskResult {
+	if t.err != nil {
+		return &TaskResult{Code: TaskFailed, Error: t.err}
+	}
+	return &TaskResult{Code: TaskSuccess}
+}
+func (t *namedTask) HandleResult(*TaskResult) {}
+func (t *namedTask) GetTaskInfo() []byte {
+	return []byte(fmt.Sprintf(`{"task_name":%q}`, t.name))
+}
+
+func receiveResults(t *testing.T, sub *ResultSubscription, n int) []*TaskResult {
+	var res []*TaskResult
+	timeout := time.After(2 * time.Second)
+	for len(res) < n {
+		select {
+		case r := <-sub.C():
+			res = append(res, r)
+		case <-timeout:
+			t.Fatalf("received %d results, want %d", len(res), n)
+		}
+	}
+	return res
+}
+
+func TestSyncTaskSystemSubscriptions(t *testing.T) {
+	s, cancel := NewSyncTaskSystem(10)
+	defer cancel()
+	s.AddWorker(NewWorker(WorkerOption{}))
+	s.Start()
+
+	all := s.SubscribeResults(10, nil)
+	failed := s.SubscribeResults(10, func(res *TaskResult) bool { return res.Code != TaskSuccess })
+	named := s.SubscribeTaskName("b", 10)
+	small := s.SubscribeResults(1, nil)
+
+	ctx, done := context.WithTimeout(context.Background(), 5*time.Second)
+	defer done()
+	for _, h := range s.TaskInQueue(&namedTask{name: "a"}, &namedTask{name: "b"}, &namedTask{name: "c", err: errors.New("boom")}) {
+		_, err := h.Wait(ctx)
+		require.NoError(t, err)
+	}
+
+	require.Len(t, receiveResults(t, all, 3), 3)
+	res := receiveResults(t, failed, 1)
+	require.Equal(t, "c", res[0].TaskName)
+	res = receiveResults(t, named, 1)
+	require.Equal(t, "b", res[0].TaskName)
+	require.NotEmpty(t, res[0].TaskId)
+
+	//buffer已滿的訂閱者丟棄結果，不影響其他訂閱者
+	require.Eventually(t, func() bool { return small.Dropped() == 2 }, time.Second, 10*time.Millisecond)
+	require.Len(t, small.C(), 1)
+
+	//取消訂閱後chan關閉，不再收到結果
+	named.Unsubscribe()
+	named.Unsubscribe()
+	_, ok := <-named.C()
+	require.False(t, ok)
+
+	_, err := s.TaskInQueue(&namedTask{name: "b"})[0].Wait(ctx)
+	require.NoError(t, err)
+	res = receiveResults(t, all, 1)
+	require.Equal(t, "b", res[0].TaskName)
+	require.Len(t, failed.C(), 0)
+}
+
+func TestPublishResultDoesNotBlock(t *testing.T) {
+	//未Start時沒有分送結果的goroutine
+	s, cancel := NewSyncTaskSystem(1)
+	defer cancel()
+
+	s.publishResult(&TaskResult{TaskName: "a"})
+	s.publishResult(&TaskResult{TaskName: "b"})
+	require.EqualValues(t, 1, s.GetStatusData().DroppedResults)
+}
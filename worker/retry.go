@@ -0,0 +1,138 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/RoyceAzure/rj/util/backoff"
+)
+
+/*
+任務重試策略
+
+	MaxAttempts: 最多執行次數(包含第一次)，<=1 表示不重試
+	InitialBackoff: 第一次重試前的等待時間
+	MaxBackoff: 等待時間上限，0表示不限制
+	Multiplier: 每次重試等待時間的倍數，<=1 視為2
+	Jitter: 等待時間隨機浮動比例(0~1)，避免大量任務同時重試
+	Retryable: 判斷錯誤是否可重試，nil 時除了PermanentError以外皆重試
+*/
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64
+	Retryable      func(error) bool
+}
+
+// 任務可選擇實作RetryableTask，覆寫系統層級的重試策略
+type RetryableTask interface {
+	GetRetryPolicy() *RetryPolicy
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// 包裝不需重試的錯誤，預設的重試判斷遇到此錯誤會直接失敗
+func PermanentError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func IsPermanentError(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
+
+/*
+計算第attempt次執行失敗後，重試前的等待時間
+
+	attempt: 已執行次數，從1開始
+*/
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	return backoff.Exponential(p.InitialBackoff, p.MaxBackoff, p.Multiplier, p.Jitter, attempt)
+}
+
+// 第attempt次執行的結果是否需要重試
+func (p *RetryPolicy) ShouldRetry(attempt int, res *TaskResult) bool {
+	if p == nil || res == nil || res.Code == TaskSuccess || res.Code == TaskCanceled {
+		return false
+	}
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(res.Error)
+	}
+	return !IsPermanentError(res.Error)
+}
+
+// 單次執行紀錄
+type TaskAttempt struct {
+	Attempt   int            `json:"attempt"`
+	StartTime time.Time      `json:"start_time"`
+	Duration  time.Duration  `json:"duration"`
+	Code      TaskResultCode `json:"code"`
+	Error     error          `json:"-"`
+}
+
+// 重試耗盡或不可重試而最終失敗的任務
+type DeadLetter struct {
+	Task       WorkerTask    `json:"-"`
+	TaskInfo   []byte        `json:"task_info"`
+	Attempts   []TaskAttempt `json:"attempts"`
+	LastResult *TaskResult   `json:"-"`
+	FailedAt   time.Time     `json:"failed_at"`
+}
+
+// 接收最終失敗(TaskFailed)或逾時(TaskTimeout)的任務，被取消的任務不會放入，可實作寫入db、mq等
+type DeadLetterSink interface {
+	Put(ctx context.Context, letter *DeadLetter) error
+}
+
+// 將func轉為DeadLetterSink
+type DeadLetterSinkFunc func(ctx context.Context, letter *DeadLetter) error
+
+func (f DeadLetterSinkFunc) Put(ctx context.Context, letter *DeadLetter) error {
+	return f(ctx, letter)
+}
+
+// 存放在記憶體的DeadLetterSink
+type MemoryDeadLetterSink struct {
+	letters []*DeadLetter
+	mu      sync.Mutex
+}
+
+func NewMemoryDeadLetterSink() *MemoryDeadLetterSink {
+	return &MemoryDeadLetterSink{}
+}
+
+func (m *MemoryDeadLetterSink) Put(ctx context.Context, letter *DeadLetter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.letters = append(m.letters, letter)
+	return nil
+}
+
+// 取出並清空目前所有DeadLetter
+func (m *MemoryDeadLetterSink) Drain() []*DeadLetter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := m.letters
+	m.letters = nil
+	return res
+}
+
+var (
+	_ DeadLetterSink = DeadLetterSinkFunc(nil)
+	_ DeadLetterSink = (*MemoryDeadLetterSink)(nil)
+)
@@ -0,0 +1,109 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type flakyTask struct {
+	failTimes int32
+	err       error
+	calls     atomic.Int32
+	done      chan *TaskResult
+}
+
+func (t *flakyTask) Excute(context.Context) *TaskResult {
+	if t.calls.Add(1) <= t.failTimes {
+		return &TaskResult{TaskName: "flaky", Code: TaskFailed, Error: t.err}
+	}
+	return &TaskResult{TaskName: "flaky", Code: TaskSuccess}
+}
+func (t *flakyTask) HandleResult(res *TaskResult) { t.done <- res }
+func (t *flakyTask) GetTaskInfo() []byte          { return []byte(`{"task_name":"flaky"}`) }
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := &RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     50 * time.Millisecond,
+		Multiplier:     2,
+	}
+	require.Equal(t, 10*time.Millisecond, p.Backoff(1))
+	require.Equal(t, 20*time.Millisecond, p.Backoff(2))
+	require.Equal(t, 40*time.Millisecond, p.Backoff(3))
+	require.Equal(t, 50*time.Millisecond, p.Backoff(4))
+
+	p.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		d := p.Backoff(1)
+		require.GreaterOrEqual(t, d, 5*time.Millisecond)
+		require.LessOrEqual(t, d, 15*time.Millisecond)
+	}
+
+	failed := &TaskResult{Code: TaskFailed, Error: errors.New("boom")}
+	require.True(t, p.ShouldRetry(1, failed))
+	require.False(t, p.ShouldRetry(5, failed))
+	require.False(t, p.ShouldRetry(1, &TaskResult{Code: TaskFailed, Error: PermanentError(errors.New("bad input"))}))
+}
+
+func TestSyncTaskSystemRetryAndDeadLetter(t *testing.T) {
+	sink := NewMemoryDeadLetterSink()
+	s, cancel := NewSyncTaskSystem(10,
+		WithRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}),
+		WithDeadLetterSink(sink),
+	)
+	defer cancel()
+	s.AddWorker(NewWorker(WorkerOption{}))
+	s.Start()
+
+	recovered := &flakyTask{failTimes: 2, err: errors.New("temporary"), done: make(chan *TaskResult, 1)}
+	exhausted := &flakyTask{failTimes: 10, err: errors.New("down"), done: make(chan *TaskResult, 1)}
+	s.TaskInQueue(recovered, exhausted)
+
+	res := <-recovered.done
+	require.Equal(t, TaskSuccess, res.Code)
+	require.EqualValues(t, 3, recovered.calls.Load())
+
+	res = <-exhausted.done
+	require.Equal(t, TaskFailed, res.Code)
+	require.EqualValues(t, 3, exhausted.calls.Load())
+
+	letters := sink.Drain()
+	require.Len(t, letters, 1)
+	require.Equal(t, exhausted, letters[0].Task)
+	require.Len(t, letters[0].Attempts, 3)
+}
+
+func TestDeadLetterSkipsCanceledTask(t *testing.T) {
+	sink := NewMemoryDeadLetterSink()
+	s, cancel := NewSyncTaskSystem(10, WithDeadLetterSink(sink))
+	defer cancel()
+	s.AddWorker(NewWorker(WorkerOption{}))
+	s.Start()
+
+	release := make(chan struct{})
+	defer close(release)
+	ctx, done := context.WithTimeout(context.Background(), 5*time.Second)
+	defer done()
+
+	timeout := &hangTask{release: release, timeout: 20 * time.Millisecond}
+	res, err := s.TaskInQueue(timeout)[0].Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, TaskTimeout, res.Code)
+
+	handle := s.TaskInQueue(&hangTask{release: release})[0]
+	time.Sleep(50 * time.Millisecond)
+	handle.Cancel()
+	res, err = handle.Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, TaskCanceled, res.Code)
+
+	letters := sink.Drain()
+	require.Len(t, letters, 1)
+	require.Equal(t, timeout, letters[0].Task)
+}
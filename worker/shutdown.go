@@ -0,0 +1,180 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrSystemClosed = errors.New("sync task system is closed")
+
+// 關閉期間各任務的處理結果
+type ShutdownReport struct {
+	Completed int           `json:"completed"` //關閉期間執行完畢的任務數
+	Abandoned int           `json:"abandoned"` //未完成且未寫入永久儲存，已遺失的任務數
+	Requeued  int           `json:"requeued"`  //未完成但已寫入永久儲存，下次Start會重新執行的任務數
+	Duration  time.Duration `json:"duration"`
+}
+
+/*
+優雅關閉系統
+
+ 1. 停止接收新任務，之後的TaskInQueue會直接以ErrSystemClosed完成
+ 2. 等待尚在放入通道的任務
+ 3. 持續將通道任務分配給worker，等待所有任務執行完畢
+ 4. ctx結束時放棄剩餘任務，已寫入永久儲存的任務保留到下次Start
+ 5. 終止系統與所有worker，等待worker flush完畢結束
+
+ctx結束而有任務未完成或worker尚未結束時，回傳report與ctx.Err()
+*/
+func (s *SyncTaskSystem) Shutdown(ctx context.Context) (*ShutdownReport, error) {
+	start := time.Now()
+	s.intakeMu.Lock()
+	if s.closed {
+		s.intakeMu.Unlock()
+		return nil, ErrSystemClosed
+	}
+	s.closed = true
+	s.intakeMu.Unlock()
+
+	finishedBefore := s.finished.Load()
+	err := s.waitIdle(ctx)
+
+	report := &ShutdownReport{}
+	if err != nil {
+		report.Abandoned, report.Requeued = s.abandonAll()
+	}
+	s.cancleFunc()
+	if werr := s.waitWorkers(ctx); err == nil {
+		err = werr
+	}
+
+	report.Completed = int(s.finished.Load() - finishedBefore)
+	report.Duration = time.Since(start)
+	s.logger.Info(context.Background(), "sync task system shutdown, completed: %d, abandoned: %d, requeued: %d",
+		report.Completed, report.Abandoned, report.Requeued)
+	return report, err
+}
+
+// 等待放入通道的goroutine結束，且所有已接收任務執行完畢
+func (s *SyncTaskSystem) waitIdle(ctx context.Context) error {
+	enqueued := make(chan struct{})
+	go func() {
+		s.enqueueWg.Wait()
+		close(enqueued)
+	}()
+	select {
+	case <-enqueued:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for s.outstanding() != 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// 等待所有worker的內部迴圈結束，ctx結束時回傳ctx.Err()
+func (s *SyncTaskSystem) waitWorkers(ctx context.Context) error {
+	for _, w := range s.GetWorkers() {
+		wk, ok := w.(interface{ Done() <-chan struct{} })
+		if !ok || wk.Done() == nil {
+			continue
+		}
+		select {
+		case <-wk.Done():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+/*
+放棄所有未完成任務，任務handle以ErrSystemClosed完成
+已在worker中的任務會被取消，且不再呼叫HandleResult
+
+	return:
+		abandoned: 未寫入永久儲存的任務數
+		requeued: 已寫入永久儲存的任務數
+*/
+func (s *SyncTaskSystem) abandonAll() (abandoned int, requeued int) {
+	s.inflightMu.Lock()
+	tasks := make([]*systemTask, 0, len(s.inflight))
+	for id, t := range s.inflight {
+		tasks = append(tasks, t)
+		delete(s.inflight, id)
+	}
+	s.inflightMu.Unlock()
+
+	for _, t := range tasks {
+		t.abandoned.Store(true)
+		t.handle.Cancel()
+		s.releaseDedup(t.WorkerTask, t.handle.Id)
+		t.handle.resolve(&TaskResult{
+			TaskId:   t.handle.Id,
+			TaskName: t.name,
+			Code:     TaskCanceled,
+			Error:    ErrSystemClosed,
+		})
+		if t.persisted {
+			requeued++
+		} else {
+			abandoned++
+		}
+	}
+	return abandoned, requeued
+}
+
+func (s *SyncTaskSystem) track(t *systemTask) {
+	s.inflightMu.Lock()
+	defer s.inflightMu.Unlock()
+	s.inflight[t.handle.Id] = t
+}
+
+// 任務執行完畢，成功時在合併模式下保留handle，與移出inflight在同一個鎖內，重複任務不會兩邊都找不到
+func (s *SyncTaskSystem) untrack(t *systemTask, res *TaskResult) {
+	s.inflightMu.Lock()
+	defer s.inflightMu.Unlock()
+	delete(s.inflight, t.handle.Id)
+	if res.Code == TaskSuccess {
+		s.keepCoalesced(t.WorkerTask, t.handle)
+	}
+}
+
+// 已接收但尚未執行完畢的任務數
+func (s *SyncTaskSystem) outstanding() int {
+	s.inflightMu.Lock()
+	defer s.inflightMu.Unlock()
+	return len(s.inflight)
+}
+
+// 系統關閉後送入的任務，不執行直接以ErrSystemClosed完成handle
+func rejectedHandles(tasks []WorkerTask, err error) []*TaskHandle {
+	handles := make([]*TaskHandle, len(tasks))
+	for i, task := range tasks {
+		name := taskNameOf(task)
+		h := newTaskHandle(name)
+		h.resolve(&TaskResult{
+			TaskId:   h.Id,
+			TaskName: name,
+			Code:     TaskCanceled,
+			Error:    err,
+		})
+		handles[i] = h
+	}
+	return handles
+}
+
+func (s *SyncTaskSystem) isClosed() bool {
+	s.intakeMu.RLock()
+	defer s.intakeMu.RUnlock()
+	return s.closed
+}
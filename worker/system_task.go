@@ -0,0 +1,312 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+/*
+SyncTaskSystem 內部包裝的任務
+所有進入系統的任務都會被包裝，由worker執行時處理系統層級的行為:
+
+  - 每次執行套用任務期限，並可由TaskHandle.Cancel取消
+  - 依重試策略重試失敗任務
+  - 最終失敗時送往DeadLetterSink
+  - 結果送入resultQueue並完成TaskHandle
+  - 完成後從永久儲存移除
+*/
+type systemTask struct {
+	WorkerTask
+	name      string
+	handle    *TaskHandle
+	lane      *taskLane
+	persisted bool        //是否已寫入永久儲存
+	abandoned atomic.Bool //系統關閉時放棄，不再處理結果
+	system    *SyncTaskSystem
+	policy    *RetryPolicy
+	timeout   time.Duration
+	attempts  []TaskAttempt
+}
+
+func (s *SyncTaskSystem) wrapTask(task WorkerTask) *systemTask {
+	policy := s.retryPolicy
+	if t, ok := task.(RetryableTask); ok {
+		if p := t.GetRetryPolicy(); p != nil {
+			policy = p
+		}
+	}
+	timeout := s.taskTimeout
+	if t, ok := task.(TimeoutTask); ok {
+		if d := t.GetTimeout(); d > 0 {
+			timeout = d
+		}
+	}
+	name := taskNameOf(task)
+	return &systemTask{
+		WorkerTask: task,
+		name:       name,
+		handle:     newTaskHandle(name),
+		system:     s,
+		policy:     policy,
+		timeout:    timeout,
+	}
+}
+
+// 經由系統middleware執行任務
+func (t *systemTask) Excute(ctx context.Context) *TaskResult {
+	return t.system.pipeline.handler(func(ctx context.Context, _ WorkerTask) *TaskResult {
+		return t.run(ctx)
+	})(ctx, t.WorkerTask)
+}
+
+/*
+依重試策略執行任務
+ctx結束或TaskHandle被取消時，回傳TaskCanceled結果
+*/
+func (t *systemTask) run(ctx context.Context) *TaskResult {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(t.handle.ctx, cancel)
+	defer stop()
+
+	for attempt := 1; ; attempt++ {
+		if ctx.Err() != nil {
+			return t.canceledResult()
+		}
+
+		start := time.Now().UTC()
+		res, running := t.excuteOnce(ctx)
+		t.attempts = append(t.attempts, TaskAttempt{
+			Attempt:   attempt,
+			StartTime: start,
+			Duration:  time.Since(start),
+			Code:      res.Code,
+			Error:     res.Error,
+		})
+
+		if !t.policy.ShouldRetry(attempt, res) {
+			return res
+		}
+		//逾時的執行仍未返回時等待其返回才重試，避免同一個任務同時執行兩次
+		if running != nil {
+			grace := time.NewTimer(attemptReturnGrace)
+			select {
+			case <-running:
+				grace.Stop()
+			case <-ctx.Done():
+				grace.Stop()
+				return t.canceledResult()
+			case <-grace.C:
+				res.Error = fmt.Errorf("attempt %d still running after %s, not retried: %w", attempt, attemptReturnGrace, res.Error)
+				return res
+			}
+		}
+
+		timer := time.NewTimer(t.policy.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return t.canceledResult()
+		case <-timer.C:
+		}
+		//每次重試都需取得token，避免重試繞過速率限制
+		if err := t.waitRetryToken(ctx); err != nil {
+			return t.canceledResult()
+		}
+	}
+}
+
+// 逾時的執行在重試前最多等待其返回的時間
+const attemptReturnGrace = time.Second
+
+/*
+執行一次任務，有設定期限時套用在本次執行
+任務在goroutine中執行，期限到或被取消時不等待任務返回，避免卡住worker
+panic時依序呼叫系統與執行worker的panic處理，轉為TaskFailed結果
+
+	return:
+		running: 任務尚未返回時不為nil，返回時關閉
+*/
+func (t *systemTask) excuteOnce(ctx context.Context) (*TaskResult, <-chan struct{}) {
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	resCh := make(chan *TaskResult, 1)
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		defer func() {
+			if r := recover(); r != nil {
+				t.system.pipeline.panic(ctx, t.WorkerTask, r)
+				//panic發生在另一個goroutine，轉交執行的worker，讓worker的Recovery middleware與OnPanic hook也能得知
+				if p := pipelineFrom(ctx); p != nil {
+					p.replayPanic(ctx, t.WorkerTask, r)
+				}
+				res := panicResult(r)
+				res.TaskName = t.name
+				resCh <- res
+			}
+		}()
+		resCh <- t.WorkerTask.Excute(ctx)
+	}()
+
+	select {
+	case res := <-resCh:
+		if res == nil {
+			return &TaskResult{
+				TaskName: t.name,
+				Code:     TaskFailed,
+				Error:    fmt.Errorf("task returned nil result"),
+			}, nil
+		}
+		//任務自行處理ctx而回傳失敗時，依ctx狀態區分逾時與取消
+		if res.Code == TaskFailed && ctx.Err() != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				res.Code = TaskTimeout
+			} else {
+				res.Code = TaskCanceled
+			}
+		}
+		return res, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return &TaskResult{
+				TaskName: t.name,
+				Code:     TaskTimeout,
+				Error:    fmt.Errorf("task %s timeout after %s: %w", t.name, t.timeout, ctx.Err()),
+			}, returned
+		}
+		return t.canceledResult(), returned
+	}
+}
+
+// 所有執行次數的總時間
+func (t *systemTask) totalDuration() time.Duration {
+	var total time.Duration
+	for _, a := range t.attempts {
+		total += a.Duration
+	}
+	return total
+}
+
+func (t *systemTask) canceledResult() *TaskResult {
+	return &TaskResult{
+		TaskName: t.name,
+		Code:     TaskCanceled,
+		Error:    fmt.Errorf("task %s canceled: %w", t.name, context.Canceled),
+	}
+}
+
+func (t *systemTask) HandleResult(res *TaskResult) {
+	if t.abandoned.Load() {
+		return
+	}
+	res.TaskId = t.handle.Id
+	if res.TaskName == "" {
+		res.TaskName = t.name
+	}
+	//取消是呼叫端的決定，不視為失敗
+	if (res.Code == TaskFailed || res.Code == TaskTimeout) && t.system.deadLetter != nil {
+		letter := &DeadLetter{
+			Task:       t.WorkerTask,
+			TaskInfo:   t.WorkerTask.GetTaskInfo(),
+			Attempts:   t.attempts,
+			LastResult: res,
+			FailedAt:   time.Now().UTC(),
+		}
+		if err := t.system.deadLetter.Put(t.system.ctx, letter); err != nil {
+			t.system.logger.Error(t.system.ctx, "put dead letter failed, err : %s", err.Error())
+		}
+	}
+	t.WorkerTask.HandleResult(res)
+	if t.persisted {
+		if err := t.system.store.Ack(t.handle.Id); err != nil {
+			t.system.logger.Error(t.system.ctx, "ack queue store failed, err : %s", err.Error())
+		}
+	}
+	t.system.metrics.record(t.name, res.Code, t.totalDuration())
+	if res.Code != TaskSuccess {
+		t.recordFailure(res)
+		t.system.releaseDedup(t.WorkerTask, t.handle.Id)
+	}
+	t.handle.resolve(res)
+	t.system.publishResult(res)
+	t.system.finished.Add(1)
+	t.system.untrack(t, res)
+	//worker有空出的prefetch名額
+	t.system.wakeDistributor()
+}
+
+// 將任務寫入永久儲存，失敗時任務仍會執行但不保證重啟後存在
+func (s *SyncTaskSystem) persist(t *systemTask) {
+	if s.store == nil || s.codecs == nil {
+		return
+	}
+	taskName, data, err := s.codecs.Encode(t.WorkerTask)
+	if err != nil {
+		s.logger.Warn(s.ctx, "task not persisted, err : %s", err.Error())
+		return
+	}
+	rec := QueueRecord{
+		Id:         t.handle.Id,
+		Lane:       t.lane.name,
+		TaskName:   taskName,
+		Payload:    data,
+		EnqueuedAt: time.Now().UTC(),
+	}
+	if err := s.store.Append(rec); err != nil {
+		s.logger.Error(s.ctx, "append queue store failed, err : %s", err.Error())
+		return
+	}
+	t.persisted = true
+}
+
+// 將永久儲存中未完成的任務解碼後重新放入通道，無法解碼的任務保留在儲存中
+func (s *SyncTaskSystem) replay() {
+	if s.store == nil || s.codecs == nil {
+		return
+	}
+	records, err := s.store.Pending()
+	if err != nil {
+		s.logger.Error(s.ctx, "load pending tasks failed, err : %s", err.Error())
+		return
+	}
+
+	tasks := make([]*systemTask, 0, len(records))
+	for _, rec := range records {
+		task, err := s.codecs.Decode(rec.TaskName, rec.Payload)
+		if err != nil {
+			s.logger.Error(s.ctx, "replay task %s failed, err : %s", rec.Id, err.Error())
+			continue
+		}
+		st := s.wrapTask(task)
+		st.handle.Id = rec.Id
+		st.persisted = true
+		lane, ok := s.lanes.getLane(rec.Lane)
+		if !ok {
+			lane = s.lanes.defaultLane
+		}
+		st.lane = lane
+		s.track(st)
+		s.pipeline.enqueue(s.ctx, task)
+		tasks = append(tasks, st)
+	}
+	if len(tasks) == 0 {
+		return
+	}
+
+	s.logger.Info(s.ctx, "replay %d pending tasks", len(tasks))
+	s.enqueueWg.Add(1)
+	go func() {
+		defer s.enqueueWg.Done()
+		for _, task := range tasks {
+			s.enqueue(task)
+		}
+	}()
+}
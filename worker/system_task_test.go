@@ -0,0 +1,138 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// 不理會ctx的任務，直到release被關閉才返回
+type hangTask struct {
+	release chan struct{}
+	timeout time.Duration
+}
+
+func (t *hangTask) Excute(context.Context) *TaskResult {
+	<-t.release
+	return &TaskResult{Code: TaskSuccess}
+}
+func (t *hangTask) HandleResult(*TaskResult)  {}
+func (t *hangTask) GetTaskInfo() []byte       { return []byte(`{"task_name":"hang"}`) }
+func (t *hangTask) GetTimeout() time.Duration { return t.timeout }
+
+func TestSystemTaskTimeoutAndCancel(t *testing.T) {
+	s, cancel := NewSyncTaskSystem(10, WithTaskTimeout(time.Hour))
+	defer cancel()
+	s.AddWorker(NewWorker(WorkerOption{}))
+	s.Start()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	ctx, done := context.WithTimeout(context.Background(), 5*time.Second)
+	defer done()
+
+	handles := s.TaskInQueue(&hangTask{release: release, timeout: 20 * time.Millisecond})
+	res, err := handles[0].Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, TaskTimeout, res.Code)
+	require.Equal(t, "hang", res.TaskName)
+
+	//逾時的任務不會卡住worker，後續任務可被取消
+	handles = s.TaskInQueue(&hangTask{release: release})
+	time.Sleep(50 * time.Millisecond)
+	handles[0].Cancel()
+	res, err = handles[0].Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, TaskCanceled, res.Code)
+}
+
+func TestSyncTaskSystemShutdown(t *testing.T) {
+	store := NewMemoryQueueStore()
+	codecs := NewTaskCodecRegistry()
+	require.NoError(t, codecs.Register("persist", TaskInfoCodec(func(info TaskInfo) (WorkerTask, error) {
+		return &persistTask{}, nil
+	})))
+	s, cancel := NewSyncTaskSystem(10, WithQueueStore(store, codecs), WithDistributeStrategy(NewLeastQueuedStrategy()))
+	defer cancel()
+	s.AddWorker(NewWorker(WorkerOption{}), NewWorker(WorkerOption{}))
+	s.Start()
+
+	release := make(chan struct{})
+	defer close(release)
+	hang := s.TaskInQueue(&hangTask{release: release})
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan string, 3)
+	s.TaskInQueue(&persistTask{Value: "a", done: done}, &persistTask{Value: "b", done: done})
+
+	ctx, done2 := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer done2()
+	report, err := s.Shutdown(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Len(t, done, 2)
+	require.Equal(t, 1, report.Abandoned)
+	require.Equal(t, 0, report.Requeued)
+
+	res := hang[0].Result()
+	require.NotNil(t, res)
+	require.ErrorIs(t, res.Error, ErrSystemClosed)
+
+	rejected := s.TaskInQueue(&persistTask{Value: "c"})
+	require.ErrorIs(t, rejected[0].Result().Error, ErrSystemClosed)
+
+	pending, err := store.Pending()
+	require.NoError(t, err)
+	require.Len(t, pending, 0)
+}
+
+// 不理會ctx，執行hold後返回，紀錄同時執行的最大數量
+type overrunTask struct {
+	hold      time.Duration
+	calls     atomic.Int32
+	active    atomic.Int32
+	maxActive atomic.Int32
+}
+
+func (t *overrunTask) Excute(context.Context) *TaskResult {
+	t.calls.Add(1)
+	n := t.active.Add(1)
+	defer t.active.Add(-1)
+	if n > t.maxActive.Load() {
+		t.maxActive.Store(n)
+	}
+	time.Sleep(t.hold)
+	return &TaskResult{Code: TaskFailed, Error: errors.New("slow")}
+}
+func (t *overrunTask) HandleResult(*TaskResult)  {}
+func (t *overrunTask) GetTaskInfo() []byte       { return []byte(`{"task_name":"overrun"}`) }
+func (t *overrunTask) GetTimeout() time.Duration { return 20 * time.Millisecond }
+
+func TestSystemTaskTimeoutRetryWaitsPreviousAttempt(t *testing.T) {
+	s, cancel := NewSyncTaskSystem(10, WithRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}))
+	defer cancel()
+	s.AddWorker(NewWorker(WorkerOption{}))
+	s.Start()
+	ctx, done := context.WithTimeout(context.Background(), 10*time.Second)
+	defer done()
+
+	//逾時的執行在寬限期內返回後才重試，不會同時執行
+	task := &overrunTask{hold: 50 * time.Millisecond}
+	res, err := s.TaskInQueue(task)[0].Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, TaskTimeout, res.Code)
+	require.EqualValues(t, 3, task.calls.Load())
+	require.EqualValues(t, 1, task.maxActive.Load())
+
+	//超過寬限期仍未返回時不重試
+	task = &overrunTask{hold: attemptReturnGrace + 500*time.Millisecond}
+	res, err = s.TaskInQueue(task)[0].Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, TaskTimeout, res.Code)
+	require.Contains(t, res.Error.Error(), "not retried")
+	require.EqualValues(t, 1, task.calls.Load())
+}
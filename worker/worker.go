@@ -3,10 +3,10 @@ package worker
 import (
 	"context"
 	"errors"
-	"fmt"
 	"log"
 	"os"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -35,6 +35,12 @@ func (l *DefaultLogger) Warn(ctx context.Context, msg string, args ...interface{
 	l.logger.Printf("[WARN] "+msg, args...)
 }
 
+func newDefaultLogger() Logger {
+	return &DefaultLogger{
+		logger: log.New(os.Stdout, "", log.LstdFlags),
+	}
+}
+
 type WorkerStatus int
 
 const (
@@ -44,8 +50,9 @@ const (
 )
 
 type WorkerOption struct {
-	TaskNum int
-	Logger  Logger
+	TaskNum      int
+	Logger       Logger
+	FlushTimeout time.Duration //worker結束時執行剩餘任務的期限，0表示10秒
 }
 
 //需要能回傳當前worker執行狀態與各種數據，讓distributor能夠決定要分配給哪個worker
@@ -65,23 +72,32 @@ type WorkerStaticsData struct {
 	CloseTime            time.Time     `json:"close_time"`
 	RunTime              time.Duration `json:"run_time"`
 	Status               WorkerStatus  `json:"status"`
+	ThrottledWaitTime    time.Duration `json:"throttled_wait_time"` //任務因速率限制延後執行的總時間
+	ThrottledCount       uint64        `json:"throttled_count"`     //因速率限制而延後的次數
 }
 
 type IWoker interface {
 	Run(context.Context)
-	FeedTask([]WorkerTask)
+	FeedTask([]WorkerTask) bool
 	GetStatusData() WorkerStaticsData
 	Reset()
 }
 
 type Worker struct {
 	statics      *WorkerStaticsData
+	staticsMu    sync.Mutex   //保護statics、done、stopping與draining
+	pendingTasks atomic.Int64 //已分配但尚未執行完的任務數
 	Id           uuid.UUID
 	option       WorkerOption
 	taskBuffer   chan []WorkerTask
-	isProcessing atomic.Bool  //標記內部迴圈是否執行
-	status       atomic.Value //worker本身狀態
+	isProcessing atomic.Bool   //標記內部迴圈是否執行
+	done         chan struct{} //內部迴圈結束時關閉
+	stopping     chan struct{} //開始停止時關閉，之後FeedTask不再接收任務
+	draining     chan struct{} //Drain時關閉，內部迴圈執行完手上任務後停止
+	feedMu       sync.RWMutex  //stop等待進行中的FeedTask結束後才flush
+	status       atomic.Value  //worker本身狀態
 	logger       Logger
+	pipeline     *taskPipeline
 }
 
 /*
@@ -93,9 +109,10 @@ type Worker struct {
 func NewWorker(option WorkerOption) *Worker {
 	id, _ := uuid.NewUUID()
 	w := &Worker{
-		Id:      id,
-		statics: &WorkerStaticsData{},
-		option:  option,
+		Id:       id,
+		statics:  &WorkerStaticsData{},
+		option:   option,
+		pipeline: newTaskPipeline(),
 	}
 	w.status.Store(Stop)
 	w.SetOption(option)
@@ -109,15 +126,25 @@ func (w *Worker) SetOption(options WorkerOption) {
 	w.taskBuffer = make(chan []WorkerTask, options.TaskNum)
 
 	if options.Logger == nil {
-		w.logger = &DefaultLogger{
-			logger: log.New(os.Stdout, "", log.LstdFlags),
-		}
+		w.logger = newDefaultLogger()
 	} else {
 		w.logger = options.Logger
 	}
 }
 
+// 註冊middleware，套用在之後執行的任務
+func (w *Worker) Use(mws ...Middleware) {
+	w.pipeline.use(mws...)
+}
+
+// 註冊任務生命週期hook，OnEnqueue在FeedTask時呼叫
+func (w *Worker) AddHooks(hooks TaskHooks) {
+	w.pipeline.addHooks(hooks)
+}
+
 func (w *Worker) GetStatusData() WorkerStaticsData {
+	w.staticsMu.Lock()
+	defer w.staticsMu.Unlock()
 	w.updateStaticData()
 	return *w.statics
 }
@@ -127,16 +154,21 @@ func (w *Worker) GetStatusData() WorkerStaticsData {
 //	  param:
 //		  dur 當前完成任務的執行時間
 func (w *Worker) finishedWork(dur time.Duration) {
+	w.staticsMu.Lock()
+	defer w.staticsMu.Unlock()
+	w.pendingTasks.Add(-1)
 	w.statics.FinishedJobCount++
 	if w.statics.AverageExecutionTime == 0 {
 		w.statics.AverageExecutionTime = dur
 	} else {
-		w.statics.AverageExecutionTime = (w.statics.AverageExecutionTime*time.Duration(w.statics.FinishedJobCount) + dur) / time.Duration(w.statics.FinishedJobCount)
+		n := time.Duration(w.statics.FinishedJobCount)
+		w.statics.AverageExecutionTime = (w.statics.AverageExecutionTime*(n-1) + dur) / n
 	}
 }
 
+// 呼叫端需持有staticsMu
 func (w *Worker) updateStaticData() {
-	w.statics.CurrentTaskCount = len(w.taskBuffer)
+	w.statics.CurrentTaskCount = int(w.pendingTasks.Load())
 	if w.statics.CloseTime.IsZero() {
 		w.statics.RunTime = time.Since(w.statics.StartTime)
 	} else {
@@ -146,7 +178,13 @@ func (w *Worker) updateStaticData() {
 }
 
 func (w *Worker) Reset() {
+	w.staticsMu.Lock()
 	w.statics = &WorkerStaticsData{}
+	w.done = nil
+	w.stopping = nil
+	w.draining = nil
+	w.staticsMu.Unlock()
+	w.pendingTasks.Store(0)
 	w.status.Store(Stop)
 	w.isProcessing.Store(false)
 	w.SetOption(w.option)
@@ -157,6 +195,13 @@ func (w *Worker) GetTaskBuffer() chan []WorkerTask {
 	return w.taskBuffer
 }
 
+// 回傳worker內部迴圈結束(包含flush完畢)時關閉的chan，尚未Run時回傳nil
+func (w *Worker) Done() <-chan struct{} {
+	w.staticsMu.Lock()
+	defer w.staticsMu.Unlock()
+	return w.done
+}
+
 /*
 統一交由外部由ctx控制是否終止
 或者內部發生致命錯誤而中止
@@ -167,29 +212,41 @@ func (w *Worker) Run(ctx context.Context) {
 		return
 	}
 
+	done := make(chan struct{})
+	stopping := make(chan struct{})
+	draining := make(chan struct{})
+	w.staticsMu.Lock()
 	w.statics.StartTime = time.Now().UTC()
+	w.done = done
+	w.stopping = stopping
+	w.draining = draining
+	w.staticsMu.Unlock()
 	w.status.Store(Running)
 
 	go func() {
 		w.isProcessing.Store(true)
+		defer close(done)
 		defer w.isProcessing.Store(false)
 
 		for {
 			select {
 			case <-ctx.Done():
-				w.stop()
+				w.stop(stopping, nil)
+				return
+			case <-draining:
+				w.stop(stopping, nil)
 				return
 			case taskList := <-w.taskBuffer:
 				if w.status.Load().(WorkerStatus) == Stop {
 					return
 				}
 				w.status.Store(Running)
-				for _, task := range taskList {
+				for i, task := range taskList {
 					err := w.processTask(ctx, task)
 					if errors.Is(err, context.Canceled) {
-						//任務執行到一半中斷，將任務放回buffer
-						w.taskBuffer <- []WorkerTask{task}
-						break
+						//任務執行到一半中斷，剩餘任務交由flush處理
+						w.stop(stopping, taskList[i:])
+						return
 					}
 				}
 			case <-time.After(time.Second * 5):
@@ -199,19 +256,74 @@ func (w *Worker) Run(ctx context.Context) {
 	}()
 }
 
+/*
+停止接收任務，執行完手上與buffer內的任務後結束內部迴圈，不取消執行中任務的ctx
+buffer內的任務與stop相同，需在FlushTimeout內執行完
+
+	return: 內部迴圈結束時關閉的chan，尚未Run時回傳nil
+*/
+func (w *Worker) Drain() <-chan struct{} {
+	w.staticsMu.Lock()
+	defer w.staticsMu.Unlock()
+	if w.draining != nil {
+		closeOnce(w.stopping)
+		closeOnce(w.draining)
+	}
+	return w.done
+}
+
+// 關閉尚未關閉的chan，呼叫端需確保不會同時關閉
+func closeOnce(ch chan struct{}) {
+	select {
+	case <-ch:
+	default:
+		close(ch)
+	}
+}
+
+// worker結束時執行剩餘任務的期限
+func (w *Worker) flushTimeout() time.Duration {
+	if w.option.FlushTimeout <= 0 {
+		return time.Second * 10
+	}
+	return w.option.FlushTimeout
+}
+
+// 紀錄任務因速率限制延後的時間
+func (w *Worker) throttled(dur time.Duration) {
+	if dur <= 0 {
+		return
+	}
+	w.staticsMu.Lock()
+	defer w.staticsMu.Unlock()
+	w.statics.ThrottledWaitTime += dur
+	w.statics.ThrottledCount++
+}
+
 // 執行一個任務，並更新worker狀態
+// 任務有執行限制且目前不可執行時延後重新分配，任務經由middleware執行，panic會轉為失敗結果
 func (w *Worker) processTask(ctx context.Context, task WorkerTask) error {
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
+	if t, ok := task.(admissionTask); ok {
+		release, retryAfter, ok := t.admit()
+		if !ok {
+			//不等待，任務延後重新分配
+			w.throttled(retryAfter)
+			w.pendingTasks.Add(-1)
+			t.deferRun(retryAfter)
+			return nil
+		}
+		defer release()
+	}
 	start := time.Now().UTC()
-	b := task.GetTaskInfo()
-	res := task.Excute(ctx)
+	res := w.pipeline.handler(excuteTask)(withPipeline(ctx, w.pipeline), task)
 
 	if res.Code == TaskSuccess {
-		w.logger.Info(ctx, "excute worker task successed", b)
+		w.logger.Info(ctx, "excute worker task successed, task info : %s", task.GetTaskInfo())
 	} else {
-		w.logger.Error(ctx, fmt.Sprintf("excute worker task failed, err : %s", (*res).Error.Error()), b)
+		w.logger.Error(ctx, "excute worker task failed, task info : %s, err : %v", task.GetTaskInfo(), res.Error)
 	}
 
 	w.finishedWork(time.Since(start))
@@ -219,11 +331,15 @@ func (w *Worker) processTask(ctx context.Context, task WorkerTask) error {
 	return nil
 }
 
-// worker 結束時，將buffer裡面的任務全部執行完
-// 任務若沒有在10秒內執行完，則會保留在buffer裡面
-func (w *Worker) flush() {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+// worker 結束時，將中斷的任務與buffer裡面的任務全部執行完
+// 任務若沒有在FlushTimeout內執行完，則會保留在buffer裡面
+func (w *Worker) flush(leftover []WorkerTask) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.flushTimeout())
 	defer cancel()
+
+	for _, task := range leftover {
+		w.processTask(context.Background(), task)
+	}
 	for {
 		select {
 		case <-ctx.Done():
@@ -240,15 +356,48 @@ func (w *Worker) flush() {
 	}
 }
 
-func (w *Worker) stop() {
+/*
+停止接收任務後flush
+關閉stopping後等待進行中的FeedTask結束，之後buffer不會再有新任務，不需要關閉buffer
+*/
+func (w *Worker) stop(stopping chan struct{}, leftover []WorkerTask) {
 	w.status.Store(Stop)
-	close(w.taskBuffer)
+	w.staticsMu.Lock()
+	closeOnce(stopping)
+	w.staticsMu.Unlock()
+	w.feedMu.Lock()
+	w.feedMu.Unlock()
+	w.staticsMu.Lock()
 	w.statics.CloseTime = time.Now().UTC()
-	w.flush()
+	w.staticsMu.Unlock()
+	w.flush(leftover)
 }
 
 /*
- */
-func (w *Worker) FeedTask(tasks []WorkerTask) {
-	w.taskBuffer <- tasks
+待處理任務數以任務為單位計算，而非buffer中的組數
+buffer已滿時等待，worker停止時不接收任務並回傳false，由呼叫端重新分配
+*/
+func (w *Worker) FeedTask(tasks []WorkerTask) bool {
+	w.feedMu.RLock()
+	defer w.feedMu.RUnlock()
+	w.staticsMu.Lock()
+	stopping := w.stopping
+	w.staticsMu.Unlock()
+	select {
+	case <-stopping:
+		return false
+	default:
+	}
+
+	for _, task := range tasks {
+		w.pipeline.enqueue(context.Background(), task)
+	}
+	w.pendingTasks.Add(int64(len(tasks)))
+	select {
+	case w.taskBuffer <- tasks:
+		return true
+	case <-stopping:
+		w.pendingTasks.Add(-int64(len(tasks)))
+		return false
+	}
 }
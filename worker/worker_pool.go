@@ -4,11 +4,17 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
 	//一個Worker分配到一組工作數量有多少個
 	WorkerProcessTaskNum = 100
+	//每個worker已分配但尚未執行完的任務上限預設值
+	DefaultPrefetch = 10
+	//distributor沒有收到新任務通知時，檢查通道的間隔
+	distributeInterval = 100 * time.Millisecond
 )
 
 var iterTaskPool = sync.Pool{
@@ -58,10 +64,137 @@ func (wp *WorkerPool) Put(w *Worker) {
 type SyncTaskSystem struct {
 	ctx         context.Context
 	cancleFunc  context.CancelFunc
-	taskQueue   chan WorkerTask
+	lanes       *laneScheduler
+	notify      chan struct{} //有新任務進入時通知distributor
 	resultQueue chan *TaskResult
-	workers     []IWoker //活耀worker
+	droppedRes  atomic.Uint64                 //resultQueue已滿而未分送的結果數
+	workers     []IWoker                      //活耀worker
+	cancels     map[IWoker]context.CancelFunc //各worker的終止函數
+	autoScalers []*AutoScaler                 //以此系統建立的AutoScaler，由mu保護
+	strategy    DistributeStrategy
+	prefetch    int //每個worker已分配但尚未執行完的任務上限
+	retryPolicy *RetryPolicy
+	taskTimeout time.Duration
+	deadLetter  DeadLetterSink
+	store       TaskQueueStore
+	codecs      *TaskCodecRegistry
+	limiters    map[string]*taskLimiter //建立後不再變動，不需要鎖
+	remote      *remotePublisher        //分散式發送模式，nil表示在本地執行
+	dedup       *dedupConfig            //nil表示不去重
+	suppressed  atomic.Uint64           //因重複而未執行的任務數
+	paused      atomic.Bool             //暫停接收任務
+	failures    *failureHistory
+	logger      Logger
+	started     atomic.Bool
 	mu          sync.RWMutex
+	subscribers map[uint64]*ResultSubscription
+	subSeq      uint64
+	subMu       sync.RWMutex
+	closed      bool //停止接收新任務
+	intakeMu    sync.RWMutex
+	enqueueWg   sync.WaitGroup //尚在放入通道的goroutine
+	inflight    map[string]*systemTask
+	coalesced   map[string]coalescedHandle //合併模式下已成功的原任務handle，由inflightMu保護
+	lastSweep   time.Time                  //上次清除過期coalesced的時間
+	inflightMu  sync.Mutex
+	finished    atomic.Uint64 //執行完畢的任務數
+	metrics     *taskMetrics
+	pipeline    *taskPipeline
+}
+
+// NewSyncTaskSystem 的可選設定
+type SystemOption func(*systemConfig)
+
+type systemConfig struct {
+	lanes          []LaneConfig
+	strategy       DistributeStrategy
+	prefetch       int
+	retryPolicy    *RetryPolicy
+	taskTimeout    time.Duration
+	deadLetter     DeadLetterSink
+	store          TaskQueueStore
+	codecs         *TaskCodecRegistry
+	rateLimits     map[string]RateLimit
+	remote         *remotePublisher
+	dedup          *dedupConfig
+	failureHistory int
+	logger         Logger
+}
+
+// 設定優先通道與權重，未設定時使用DefaultLanes
+func WithLanes(lanes ...LaneConfig) SystemOption {
+	return func(cfg *systemConfig) {
+		cfg.lanes = lanes
+	}
+}
+
+// 設定任務分配策略，未設定時使用RoundRobinStrategy
+func WithDistributeStrategy(strategy DistributeStrategy) SystemOption {
+	return func(cfg *systemConfig) {
+		cfg.strategy = strategy
+	}
+}
+
+/*
+設定每個worker已分配但尚未執行完的任務上限，<=0 時使用DefaultPrefetch
+任務在分配時才依通道權重取出，上限越小，critical任務越不會排在已分配給worker的大量bulk任務之後
+*/
+func WithPrefetch(n int) SystemOption {
+	return func(cfg *systemConfig) {
+		cfg.prefetch = n
+	}
+}
+
+// 設定系統層級的重試策略，任務實作RetryableTask時以任務設定為主
+func WithRetryPolicy(policy *RetryPolicy) SystemOption {
+	return func(cfg *systemConfig) {
+		cfg.retryPolicy = policy
+	}
+}
+
+// 設定任務單次執行期限，任務實作TimeoutTask時以任務設定為主，0表示不限制
+func WithTaskTimeout(timeout time.Duration) SystemOption {
+	return func(cfg *systemConfig) {
+		cfg.taskTimeout = timeout
+	}
+}
+
+// 設定最終失敗任務的接收者
+func WithDeadLetterSink(sink DeadLetterSink) SystemOption {
+	return func(cfg *systemConfig) {
+		cfg.deadLetter = sink
+	}
+}
+
+/*
+設定任務佇列永久儲存，任務以codecs依TaskName編碼後寫入
+沒有註冊codec的任務不會寫入，只存在於記憶體
+*/
+func WithQueueStore(store TaskQueueStore, codecs *TaskCodecRegistry) SystemOption {
+	return func(cfg *systemConfig) {
+		cfg.store = store
+		cfg.codecs = codecs
+	}
+}
+
+/*
+設定TaskName的執行速率與同時執行上限
+限制在worker執行任務前生效，不可執行的任務延後重新分配，延後時間計入worker的ThrottledWaitTime
+重試的每次執行都需取得token
+*/
+func WithTaskRateLimit(taskName string, limit RateLimit) SystemOption {
+	return func(cfg *systemConfig) {
+		if cfg.rateLimits == nil {
+			cfg.rateLimits = make(map[string]RateLimit)
+		}
+		cfg.rateLimits[taskName] = limit
+	}
+}
+
+func WithLogger(logger Logger) SystemOption {
+	return func(cfg *systemConfig) {
+		cfg.logger = logger
+	}
 }
 
 /*
@@ -69,49 +202,188 @@ todo : woker應該要用註冊的方式
 
 @parm
 
-	qsize:taskQueue 大小
+	qsize:每個通道預設大小
+	opts: 可選設定，通道設定錯誤(名稱重複或空白)時會panic
 */
-func NewSyncTaskSystem(qsize int) (*SyncTaskSystem, context.CancelFunc) {
+func NewSyncTaskSystem(qsize int, opts ...SystemOption) (*SyncTaskSystem, context.CancelFunc) {
+	cfg := &systemConfig{
+		strategy: NewRoundRobinStrategy(),
+		logger:   newDefaultLogger(),
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.prefetch <= 0 {
+		cfg.prefetch = DefaultPrefetch
+	}
+
+	lanes, err := newLaneScheduler(cfg.lanes, qsize)
+	if err != nil {
+		panic(fmt.Sprintf("invalid lane config: %v", err))
+	}
+
+	limiters := make(map[string]*taskLimiter, len(cfg.rateLimits))
+	for name, limit := range cfg.rateLimits {
+		limiters[name] = newTaskLimiter(limit)
+	}
+
 	ctx, cancle := context.WithCancel(context.Background())
 	return &SyncTaskSystem{
 		ctx:         ctx,
 		cancleFunc:  cancle,
-		taskQueue:   make(chan WorkerTask, qsize),
+		lanes:       lanes,
+		strategy:    cfg.strategy,
+		prefetch:    cfg.prefetch,
+		retryPolicy: cfg.retryPolicy,
+		taskTimeout: cfg.taskTimeout,
+		deadLetter:  cfg.deadLetter,
+		store:       cfg.store,
+		codecs:      cfg.codecs,
+		limiters:    limiters,
+		remote:      cfg.remote,
+		dedup:       cfg.dedup,
+		failures:    newFailureHistory(cfg.failureHistory),
+		logger:      cfg.logger,
+		cancels:     make(map[IWoker]context.CancelFunc),
+		subscribers: make(map[uint64]*ResultSubscription),
+		inflight:    make(map[string]*systemTask),
+		metrics:     newTaskMetrics(),
+		pipeline:    newTaskPipeline(),
+		notify:      make(chan struct{}, 1),
 		resultQueue: make(chan *TaskResult, qsize),
 	}, cancle
 }
 
+/*
+註冊系統層級middleware，套用在之後執行的所有任務
+middleware包含重試在內的整個任務執行，task參數為送入系統的原始任務
+*/
+func (s *SyncTaskSystem) Use(mws ...Middleware) {
+	s.pipeline.use(mws...)
+}
+
+/*
+註冊系統層級任務生命週期hook
+OnSuccess、OnFailure在重試結束後以最終結果呼叫一次，OnPanic在每次panic時呼叫
+*/
+func (s *SyncTaskSystem) AddHooks(hooks TaskHooks) {
+	s.pipeline.addHooks(hooks)
+}
+
+// 系統已啟動時，新加入的worker會直接Run
 func (s *SyncTaskSystem) AddWorker(workers ...IWoker) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.workers = append(s.workers, workers...)
+	if s.started.Load() {
+		for _, w := range workers {
+			s.runWorker(w)
+		}
+	}
+}
+
+/*
+將worker從活耀worker中移除，worker停止接收任務，執行完手上與buffer內的任務後停止
+超過worker的FlushTimeout仍未停止時才取消worker的ctx
+回傳false表示worker不在系統中
+*/
+func (s *SyncTaskSystem) RemoveWorker(worker IWoker) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, w := range s.workers {
+		if w != worker {
+			continue
+		}
+		s.workers = append(s.workers[:i], s.workers[i+1:]...)
+		if cancel, ok := s.cancels[w]; ok {
+			delete(s.cancels, w)
+			retireWorker(w, cancel)
+		}
+		return true
+	}
+	return false
+}
+
+// worker可選擇實作drainableWorker，移除時不中斷執行中的任務
+type drainableWorker interface {
+	Drain() <-chan struct{}
+	flushTimeout() time.Duration
 }
 
 /*
 used go routine inside
 
-todo 分配工作部分可以優化
+立即停止worker接收任務，由goroutine等待worker執行完手上的任務或逾時後取消ctx
+未實作drainableWorker時直接取消
+*/
+func retireWorker(w IWoker, cancel context.CancelFunc) {
+	d, ok := w.(drainableWorker)
+	if !ok {
+		cancel()
+		return
+	}
+	done := d.Drain()
+	if done == nil {
+		cancel()
+		return
+	}
+	go func() {
+		timer := time.NewTimer(d.flushTimeout())
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-timer.C:
+		}
+		cancel()
+	}()
+}
+
+var _ drainableWorker = (*Worker)(nil)
+
+// 回傳目前活耀worker
+func (s *SyncTaskSystem) GetWorkers() []IWoker {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]IWoker, len(s.workers))
+	copy(res, s.workers)
+	return res
+}
+
+// 每個worker使用獨立的子ctx，讓worker可以單獨被移除
+// 呼叫端需持有mu
+func (s *SyncTaskSystem) runWorker(w IWoker) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.cancels[w] = cancel
+	w.Run(ctx)
+}
+
+/*
+used go routine inside
+
+有新任務進入或每隔distributeInterval檢查一次通道
+有設定永久儲存時，先將上次未完成的任務重新放入通道
 */
 func (s *SyncTaskSystem) Start() {
+	s.mu.Lock()
+	s.started.Store(true)
 	for _, w := range s.workers {
-		w.Run(s.ctx)
+		s.runWorker(w)
 	}
+	s.mu.Unlock()
+	s.replay()
+	s.dispatchResults()
 	go func() {
+		ticker := time.NewTicker(distributeInterval)
+		defer ticker.Stop()
 		for {
 			select {
 			case <-s.ctx.Done():
 				fmt.Println("Stop SyncTaskSystem")
 				return
-			default:
-				if len(s.taskQueue) != 0 {
-					s.mu.RLock()
-					for _, w := range s.workers {
-						taskToFeed := s.taskDistributor(WorkerProcessTaskNum)
-						w.FeedTask(taskToFeed)
-					}
-					s.mu.RUnlock()
-				}
+			case <-s.notify:
+			case <-ticker.C:
 			}
+			s.distribute()
 		}
 	}()
 }
@@ -120,7 +392,80 @@ func (s *SyncTaskSystem) Stop() {
 	s.cancleFunc()
 }
 
+// 將通道內任務依分配策略分配給worker，直到通道清空或沒有可分配的worker
+func (s *SyncTaskSystem) distribute() {
+	for s.lanes.len() != 0 {
+		if s.ctx.Err() != nil {
+			return
+		}
+		if !s.distributeOnce() {
+			return
+		}
+	}
+}
+
+// 分配一組任務，沒有可分配的worker或沒有任務時回傳false
+func (s *SyncTaskSystem) distributeOnce() bool {
+	worker, taskToFeed := s.nextBatch()
+	if len(taskToFeed) == 0 {
+		return false
+	}
+	//FeedTask在buffer已滿時會等待，不可持有mu，避免阻塞AddWorker、RemoveWorker
+	if !worker.FeedTask(taskToFeed) {
+		//worker已停止，任務放回原通道等待重新分配
+		s.requeue(taskToFeed)
+	}
+	return true
+}
+
 /*
+依分配策略選擇worker並取出一組任務
+已分配任務數達prefetch的worker不參與分配，每組任務不超過worker剩餘的名額
+任務留在通道直到worker有名額，讓通道權重在分配時生效
+*/
+func (s *SyncTaskSystem) nextBatch() (IWoker, []WorkerTask) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.workers) == 0 {
+		return nil, nil
+	}
+	stats := make([]WorkerStaticsData, len(s.workers))
+	for i, w := range s.workers {
+		stats[i] = w.GetStatusData()
+		if stats[i].CurrentTaskCount >= s.prefetch {
+			stats[i].Status = Stop
+		}
+	}
+
+	idx, size := s.strategy.Next(stats, s.prefetch)
+	if idx < 0 || idx >= len(s.workers) || size <= 0 {
+		return nil, nil
+	}
+	if free := s.prefetch - stats[idx].CurrentTaskCount; size > free {
+		size = free
+	}
+	return s.workers[idx], s.taskDistributor(size)
+}
+
+// 將worker未接收的任務放回原通道
+func (s *SyncTaskSystem) requeue(tasks []WorkerTask) {
+	requeued := make([]*systemTask, 0, len(tasks))
+	for _, task := range tasks {
+		if st, ok := task.(*systemTask); ok {
+			requeued = append(requeued, st)
+		}
+	}
+	go func() {
+		for _, task := range requeued {
+			s.enqueue(task)
+		}
+	}()
+}
+
+/*
+依通道權重取出一組任務
+
 parm
 
 	size: 每組任務數量
@@ -128,23 +473,156 @@ parm
 func (s *SyncTaskSystem) taskDistributor(size int) []WorkerTask {
 	bufferTaskPool := iterTaskPool.Get().([]WorkerTask)[:0]
 	for i := 0; i < size; i++ {
-		select {
-		case task, ok := <-s.taskQueue:
-			if !ok {
-				break
-			}
-			bufferTaskPool = append(bufferTaskPool, task)
-		default:
+		task, ok := s.lanes.next()
+		if !ok {
 			return bufferTaskPool
 		}
+		bufferTaskPool = append(bufferTaskPool, task)
 	}
 	return bufferTaskPool
 }
 
-func (s *SyncTaskSystem) TaskInQueue(tasks ...WorkerTask) {
+/*
+任務依LaneTask放入對應通道，未實作則放入預設通道
+
+	return: 與tasks順序相同的TaskHandle，可用來等待個別任務結果
+*/
+func (s *SyncTaskSystem) TaskInQueue(tasks ...WorkerTask) []*TaskHandle {
+	return s.submit(nil, tasks)
+}
+
+// 將任務放入指定通道
+func (s *SyncTaskSystem) TaskInLane(lane string, tasks ...WorkerTask) ([]*TaskHandle, error) {
+	l, ok := s.lanes.getLane(lane)
+	if !ok {
+		return nil, fmt.Errorf("lane %s not found", lane)
+	}
+	return s.submit(l, tasks), nil
+}
+
+/*
+接收任務，重複任務依去重設定處理
+分散式發送模式下將任務發送到遠端，否則在本地執行
+
+	lane: nil 表示依任務決定通道
+*/
+func (s *SyncTaskSystem) submit(lane *taskLane, tasks []WorkerTask) []*TaskHandle {
+	if s.isClosed() {
+		return rejectedHandles(tasks, ErrSystemClosed)
+	}
+	if s.IntakePaused() {
+		return rejectedHandles(tasks, ErrIntakePaused)
+	}
+	handles, accepted, ids, idx, aliases := s.filterDuplicates(tasks)
+	if len(accepted) == 0 {
+		return handles
+	}
+
+	var acceptedHandles []*TaskHandle
+	if s.remote != nil {
+		acceptedHandles = s.publishRemote(lane, accepted, ids)
+	} else {
+		acceptedHandles = s.accept(lane, accepted, ids)
+	}
+	for i, h := range acceptedHandles {
+		handles[idx[i]] = h
+	}
+	for i, pos := range aliases {
+		handles[i] = acceptedHandles[pos]
+	}
+	return handles
+}
+
+/*
+包裝任務並寫入永久儲存後，由goroutine放入通道
+系統已關閉時不執行任務，handle直接以ErrSystemClosed完成
+
+	lane: nil 表示依任務決定通道
+	ids: 指定任務handle id，nil時自動產生
+*/
+func (s *SyncTaskSystem) accept(lane *taskLane, tasks []WorkerTask, ids []string) []*TaskHandle {
+	s.intakeMu.RLock()
+	if s.closed {
+		s.intakeMu.RUnlock()
+		for i := range ids {
+			s.releaseDedup(tasks[i], ids[i])
+		}
+		return rejectedHandles(tasks, ErrSystemClosed)
+	}
+	s.enqueueWg.Add(1)
+	s.intakeMu.RUnlock()
+
+	wrapped := make([]*systemTask, len(tasks))
+	handles := make([]*TaskHandle, len(tasks))
+	for i, task := range tasks {
+		st := s.wrapTask(task)
+		if ids != nil {
+			st.handle.Id = ids[i]
+		}
+		st.lane = lane
+		if st.lane == nil {
+			st.lane = s.lanes.laneOf(task)
+		}
+		s.track(st)
+		s.persist(st)
+		s.pipeline.enqueue(s.ctx, task)
+		wrapped[i] = st
+		handles[i] = st.handle
+	}
 	go func() {
-		for _, task := range tasks {
-			s.taskQueue <- task
+		defer s.enqueueWg.Done()
+		for _, task := range wrapped {
+			s.enqueue(task)
 		}
 	}()
+	return handles
+}
+
+// 系統終止或任務已被放棄時不放入通道
+func (s *SyncTaskSystem) enqueue(task *systemTask) {
+	if task.abandoned.Load() {
+		return
+	}
+	select {
+	case task.lane.queue <- task:
+	case <-s.ctx.Done():
+		return
+	}
+	s.wakeDistributor()
+}
+
+// 通知distributor檢查通道，已有通知時略過
+func (s *SyncTaskSystem) wakeDistributor() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+type SystemStaticsData struct {
+	QueueDepth      int               `json:"queue_depth"`
+	WorkerCount     int               `json:"worker_count"`
+	Lanes           []LaneStaticsData `json:"lanes"`
+	SuppressedCount uint64            `json:"suppressed_count"` //因重複而未執行的任務數
+	DroppedResults  uint64            `json:"dropped_results"`  //resultQueue已滿而未送給訂閱者的結果數
+}
+
+// 回傳系統狀態，包含各通道深度
+func (s *SyncTaskSystem) GetStatusData() SystemStaticsData {
+	s.mu.RLock()
+	workerCount := len(s.workers)
+	s.mu.RUnlock()
+
+	lanes := s.lanes.statics()
+	depth := 0
+	for _, lane := range lanes {
+		depth += lane.Depth
+	}
+	return SystemStaticsData{
+		QueueDepth:      depth,
+		WorkerCount:     workerCount,
+		Lanes:           lanes,
+		SuppressedCount: s.suppressed.Load(),
+		DroppedResults:  s.droppedRes.Load(),
+	}
 }
@@ -3,6 +3,7 @@ package worker
 import (
 	"context"
 	"encoding/json"
+	"time"
 )
 
 type TaskResultCode int
@@ -10,15 +11,20 @@ type TaskResultCode int
 const (
 	TaskSuccess TaskResultCode = iota
 	TaskFailed
+	TaskTimeout   //超過任務執行期限
+	TaskCanceled  //任務被取消
+	TaskPublished //分散式發送模式下已交給producer，執行結果由遠端系統處理
 )
 
 type BaseTaskInfo struct {
-	TaskName string `json:"task_name"`
-	Module   string `json:"module"`
-	Action   string `json:"action"`
+	TaskName       string `json:"task_name"`
+	Module         string `json:"module"`
+	Action         string `json:"action"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"` //啟用WithDedup時，相同鍵的任務在期限內只執行一次
 }
 
 type TaskResult struct {
+	TaskId   string `json:"task_id"` //由SyncTaskSystem設定，對應TaskHandle.Id
 	TaskName string `json:"task_name"`
 	Code     TaskResultCode
 	Response any
@@ -36,3 +42,12 @@ type WorkerTask interface {
 	HandleResult(*TaskResult)
 	GetTaskInfo() []byte
 }
+
+/*
+任務可選擇實作TimeoutTask，覆寫系統層級的單次執行期限
+逾時後系統不等待Excute返回，Excute應在ctx結束時盡快返回
+重試前最多等待上一次執行返回1秒，仍未返回時不重試，同一個任務不會同時執行兩次
+*/
+type TimeoutTask interface {
+	GetTimeout() time.Duration
+}
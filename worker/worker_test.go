@@ -0,0 +1,120 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerFeedTaskWhileStopping(t *testing.T) {
+	w := NewWorker(WorkerOption{TaskNum: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	w.Run(ctx)
+
+	//停止期間同時送入任務，不可panic，被接收的任務都會執行
+	var accepted, executed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				task := &funcTask{fn: func() { executed.Add(1) }}
+				if w.FeedTask([]WorkerTask{task}) {
+					accepted.Add(1)
+				}
+			}
+		}()
+	}
+	time.Sleep(5 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	select {
+	case <-w.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker not stopped")
+	}
+	require.Equal(t, accepted.Load(), executed.Load())
+	require.False(t, w.FeedTask([]WorkerTask{&funcTask{fn: func() {}}}))
+}
+
+func TestSyncTaskSystemShutdownWaitsWorkers(t *testing.T) {
+	s, cancel := NewSyncTaskSystem(10)
+	defer cancel()
+	w := NewWorker(WorkerOption{})
+	s.AddWorker(w)
+	s.Start()
+
+	s.TaskInQueue(&valueTask{}, &valueTask{})
+	report, err := s.Shutdown(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Completed)
+	select {
+	case <-w.Done():
+	default:
+		t.Fatal("shutdown returned before worker stopped")
+	}
+}
+
+type funcTask struct {
+	fn func()
+}
+
+func (t *funcTask) Excute(context.Context) *TaskResult {
+	t.fn()
+	return &TaskResult{Code: TaskSuccess}
+}
+func (t *funcTask) HandleResult(*TaskResult) {}
+func (t *funcTask) GetTaskInfo() []byte      { return []byte(`{"task_name":"func"}`) }
+
+// 執行期間不檢查取消以外的條件，ctx被取消時回傳TaskCanceled
+type slowTask struct {
+	started chan struct{}
+	dur     time.Duration
+}
+
+func (t *slowTask) Excute(ctx context.Context) *TaskResult {
+	close(t.started)
+	select {
+	case <-time.After(t.dur):
+		return &TaskResult{Code: TaskSuccess}
+	case <-ctx.Done():
+		return &TaskResult{Code: TaskCanceled, Error: ctx.Err()}
+	}
+}
+func (t *slowTask) HandleResult(*TaskResult) {}
+func (t *slowTask) GetTaskInfo() []byte      { return []byte(`{"task_name":"slow"}`) }
+
+func TestSyncTaskSystemRemoveBusyWorker(t *testing.T) {
+	s, cancel := NewSyncTaskSystem(10)
+	defer cancel()
+	w := NewWorker(WorkerOption{})
+	s.AddWorker(w)
+	s.Start()
+
+	task := &slowTask{started: make(chan struct{}), dur: 200 * time.Millisecond}
+	queued := &funcTask{fn: func() {}}
+	handles := s.TaskInQueue(task, queued)
+	<-task.started
+
+	//移除時執行中與buffer內的任務都執行完畢
+	require.True(t, s.RemoveWorker(w))
+	require.False(t, w.FeedTask([]WorkerTask{&funcTask{fn: func() {}}}))
+	ctx, done := context.WithTimeout(context.Background(), 5*time.Second)
+	defer done()
+	for _, h := range handles {
+		res, err := h.Wait(ctx)
+		require.NoError(t, err)
+		require.Equal(t, TaskSuccess, res.Code)
+	}
+	select {
+	case <-w.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker not stopped")
+	}
+}